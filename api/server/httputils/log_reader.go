@@ -0,0 +1,75 @@
+package httputils
+
+import (
+	"bytes"
+	"io"
+
+	"golang.org/x/net/context"
+
+	"github.com/docker/docker/api/types/backend"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// logMessageReader is an io.Reader over a channel of log messages
+type logMessageReader struct {
+	ctx  context.Context
+	msgs <-chan *backend.LogMessage
+
+	// buf holds what is left of the current message
+	buf bytes.Buffer
+	// stdout and stderr write framed messages to buf, if framing is on
+	stdout, stderr io.Writer
+	err            error
+}
+
+// NewLogMessageReader returns an io.Reader of the lines of the log messages
+// received on msgs. If mux is true, each line is framed with a stdcopy header
+// for its source, like WriteLogStream does, and messages from sources other
+// than stdout and stderr are skipped.
+//
+// Reading returns the error of the first message that has one, io.EOF once
+// msgs is closed, or the context's error if it is done first.
+func NewLogMessageReader(ctx context.Context, msgs <-chan *backend.LogMessage, mux bool) io.Reader {
+	r := &logMessageReader{ctx: ctx, msgs: msgs}
+	if mux {
+		r.stdout = stdcopy.NewStdWriter(&r.buf, stdcopy.Stdout)
+		r.stderr = stdcopy.NewStdWriter(&r.buf, stdcopy.Stderr)
+	}
+	return r
+}
+
+func (r *logMessageReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.next()
+	}
+	return r.buf.Read(p)
+}
+
+// next fills buf with the next message, or sets err if there isn't one
+func (r *logMessageReader) next() {
+	var (
+		msg *backend.LogMessage
+		ok  bool
+	)
+	select {
+	case <-r.ctx.Done():
+		r.err = r.ctx.Err()
+		return
+	case msg, ok = <-r.msgs:
+	}
+	switch {
+	case !ok:
+		r.err = io.EOF
+	case msg.Err != nil:
+		r.err = msg.Err
+	case r.stdout == nil:
+		r.buf.Write(msg.Line)
+	case msg.Source == "stdout":
+		r.stdout.Write(msg.Line)
+	case msg.Source == "stderr":
+		r.stderr.Write(msg.Line)
+	}
+}
@@ -0,0 +1,65 @@
+package httputils
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/docker/docker/api/types/backend"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+func TestLogMessageReader(t *testing.T) {
+	msgs := make(chan *backend.LogMessage, 3)
+	msgs <- &backend.LogMessage{Line: []byte("hello\n"), Source: "stdout"}
+	msgs <- &backend.LogMessage{Line: []byte("oops\n"), Source: "stderr"}
+	msgs <- &backend.LogMessage{Line: []byte("bye\n"), Source: "stdout"}
+	close(msgs)
+
+	out, err := ioutil.ReadAll(NewLogMessageReader(context.Background(), msgs, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "hello\noops\nbye\n" {
+		t.Fatalf("unexpected output %q", out)
+	}
+}
+
+func TestLogMessageReaderMux(t *testing.T) {
+	msgs := make(chan *backend.LogMessage, 3)
+	msgs <- &backend.LogMessage{Line: []byte("hello\n"), Source: "stdout"}
+	msgs <- &backend.LogMessage{Line: []byte("oops\n"), Source: "stderr"}
+	msgs <- &backend.LogMessage{Line: []byte("exit\n"), Source: backend.LogSourceExit}
+	close(msgs)
+
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, NewLogMessageReader(context.Background(), msgs, true)); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "hello\n" || stderr.String() != "oops\n" {
+		t.Fatalf("unexpected output: stdout %q, stderr %q", stdout.String(), stderr.String())
+	}
+}
+
+func TestLogMessageReaderErrors(t *testing.T) {
+	msgs := make(chan *backend.LogMessage, 2)
+	msgs <- &backend.LogMessage{Line: []byte("hello\n"), Source: "stdout"}
+	msgs <- &backend.LogMessage{Err: errors.New("broken")}
+
+	out, err := ioutil.ReadAll(NewLogMessageReader(context.Background(), msgs, false))
+	if err == nil || err.Error() != "broken" {
+		t.Fatalf("expected message error, got %v", err)
+	}
+	if string(out) != "hello\n" {
+		t.Fatalf("expected lines before the error to be read, got %q", out)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ioutil.ReadAll(NewLogMessageReader(ctx, make(chan *backend.LogMessage), false)); err != context.Canceled {
+		t.Fatalf("expected context error, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package httputils
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// RotatingWriter is a writer, usually of files, that can start over with a
+// new file. WriteLogStream rotates it between lines, when the rotation size
+// or interval in its config are reached.
+type RotatingWriter interface {
+	io.Writer
+	// Rotate closes off what has been written so far, so that the next
+	// write starts a new file
+	Rotate() error
+}
+
+// rotator counts what is written through it, and rotates a RotatingWriter
+// once too much has been written, or it has been written to for too long
+type rotator struct {
+	w       io.Writer
+	r       RotatingWriter
+	maxSize int64
+	maxAge  time.Duration
+
+	size    int64
+	started time.Time
+}
+
+// newRotator returns a rotator writing to w, which is r or writes to it
+func newRotator(w io.Writer, r RotatingWriter, maxSize int64, maxAge time.Duration) *rotator {
+	return &rotator{w: w, r: r, maxSize: maxSize, maxAge: maxAge, started: time.Now()}
+}
+
+func (r *rotator) Write(p []byte) (int, error) {
+	n, err := r.w.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Flush flushes the underlying writer, if it can be
+func (r *rotator) Flush() {
+	if f, ok := r.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// maybeRotate rotates the writer if it is due. it must only be called
+// between lines. a file that hasn't been written to is never rotated, so a
+// file goes over the size by at most one line. a nil rotator does nothing.
+func (r *rotator) maybeRotate() error {
+	if r == nil || r.size == 0 {
+		return nil
+	}
+	if (r.maxSize <= 0 || r.size < r.maxSize) && (r.maxAge <= 0 || time.Since(r.started) < r.maxAge) {
+		return nil
+	}
+	if err := r.r.Rotate(); err != nil {
+		return err
+	}
+	r.size = 0
+	r.started = time.Now()
+	return nil
+}
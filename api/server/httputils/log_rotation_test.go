@@ -0,0 +1,90 @@
+package httputils
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/backend"
+)
+
+// rotatingBuffer is a RotatingWriter that starts a new buffer on each rotation
+type rotatingBuffer struct {
+	files []*bytes.Buffer
+}
+
+func (b *rotatingBuffer) Write(p []byte) (int, error) {
+	if len(b.files) == 0 {
+		b.files = append(b.files, &bytes.Buffer{})
+	}
+	return b.files[len(b.files)-1].Write(p)
+}
+
+func (b *rotatingBuffer) Rotate() error {
+	b.files = append(b.files, &bytes.Buffer{})
+	return nil
+}
+
+func (b *rotatingBuffer) contents() []string {
+	var s []string
+	for _, f := range b.files {
+		s = append(s, f.String())
+	}
+	return s
+}
+
+func writeRotatingLogs(t *testing.T, config *backend.ContainerLogsConfig, lines ...string) []string {
+	msgs := make(chan *backend.LogMessage, len(lines))
+	for _, line := range lines {
+		msgs <- &backend.LogMessage{Line: []byte(line), Source: "stdout"}
+	}
+	close(msgs)
+
+	var b rotatingBuffer
+	if err := WriteLogStreamWithResult(context.Background(), &b, msgs, config, false); err != nil {
+		t.Fatal(err)
+	}
+	return b.contents()
+}
+
+func TestWriteLogStreamRotateSize(t *testing.T) {
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, SkipInitialFlush: true, RotateSize: 8}
+	files := writeRotatingLogs(t, config, "one\n", "two\n", "three\n", "four\n")
+	expected := []string{"one\ntwo\n", "three\nfour\n"}
+	if len(files) != len(expected) {
+		t.Fatalf("expected %q, got %q", expected, files)
+	}
+	for i := range expected {
+		if files[i] != expected[i] {
+			t.Fatalf("expected %q, got %q", expected, files)
+		}
+	}
+
+	// the tail buffer is rotated between lines too
+	config.TailBuffer = 3
+	files = writeRotatingLogs(t, config, "one\n", "two\n", "three\n", "four\n")
+	expected = []string{"two\nthree\n", "four\n"}
+	if len(files) != len(expected) || files[0] != expected[0] || files[1] != expected[1] {
+		t.Fatalf("expected %q, got %q", expected, files)
+	}
+}
+
+func TestWriteLogStreamRotateInterval(t *testing.T) {
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, SkipInitialFlush: true, RotateInterval: time.Nanosecond}
+	files := writeRotatingLogs(t, config, "one\n", "two\n")
+	if len(files) != 2 || files[0] != "one\n" || files[1] != "two\n" {
+		t.Fatalf("expected a file per line, got %q", files)
+	}
+}
+
+func TestWriteLogStreamRotateNeedsRotatingWriter(t *testing.T) {
+	msgs := make(chan *backend.LogMessage)
+	close(msgs)
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, RotateSize: 8}
+	if err := WriteLogStreamWithResult(context.Background(), &bytes.Buffer{}, msgs, config, false); err == nil {
+		t.Fatal("expected an error for a writer that can not be rotated")
+	}
+}
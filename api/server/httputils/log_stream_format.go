@@ -0,0 +1,156 @@
+package httputils
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"github.com/docker/docker/api/types/versions"
+)
+
+// LogStreamFormat is how a log stream is written in a response
+type LogStreamFormat struct {
+	// Mux is passed on to WriteLogStream
+	Mux bool
+	// JSONLines is set on the logs config passed to WriteLogStream
+	JSONLines bool
+	// Gzip compresses the stream
+	Gzip bool
+	// ContentType is the content type of the response, if the client asked
+	// for one explicitly
+	ContentType string
+}
+
+// logStreamContentTypes are the content types a log stream can be written
+// as, and how. the multiplexed stream can only be chosen if it is the
+// default, that is, if the container doesn't have a TTY.
+var logStreamContentTypes = map[string]func(f *LogStreamFormat){
+	"application/vnd.docker.multiplexed-stream": func(f *LogStreamFormat) { f.Mux = true },
+	"application/vnd.docker.raw-stream":         func(f *LogStreamFormat) { f.Mux = false },
+	"text/plain":                                func(f *LogStreamFormat) { f.Mux = false },
+	"application/x-ndjson":                      func(f *LogStreamFormat) { f.Mux, f.JSONLines = false, true },
+	"application/json":                          func(f *LogStreamFormat) { f.Mux, f.JSONLines = false, true },
+}
+
+// NegotiateLogStreamFormat picks the format of a log stream from the Accept
+// and Accept-Encoding headers of the request. Without an Accept header, or
+// one that doesn't name any format we can write, the streams are
+// multiplexed unless the container has a TTY, as they always have been.
+//
+// The headers are only looked at from API version 1.31 on. Clients often
+// send Accept-Encoding without expecting the logs to be compressed, so the
+// stream is only compressed if the client also asked for a format other
+// than the default one.
+func NegotiateLogStreamFormat(ctx context.Context, r *http.Request, tty bool) LogStreamFormat {
+	f := LogStreamFormat{Mux: !tty}
+	if versions.LessThan(VersionFromContext(ctx), "1.31") {
+		return f
+	}
+	for _, mediaType := range acceptedValues(r.Header.Get("Accept")) {
+		if mediaType == "application/vnd.docker.multiplexed-stream" && tty {
+			continue
+		}
+		if set, ok := logStreamContentTypes[mediaType]; ok {
+			set(&f)
+			f.ContentType = mediaType
+			break
+		}
+	}
+	defaultContentType := "application/vnd.docker.multiplexed-stream"
+	if tty {
+		defaultContentType = "application/vnd.docker.raw-stream"
+	}
+	if f.ContentType == "" || f.ContentType == defaultContentType {
+		return f
+	}
+	for _, encoding := range acceptedValues(r.Header.Get("Accept-Encoding")) {
+		if encoding == "gzip" {
+			f.Gzip = true
+			break
+		}
+	}
+	return f
+}
+
+// ResponseWriter sets the headers for the format on w, and returns the
+// writer the log stream should be written to, and a function to call once
+// the stream is done.
+func (f LogStreamFormat) ResponseWriter(w http.ResponseWriter) (io.Writer, func()) {
+	if f.ContentType != "" {
+		w.Header().Set("Content-Type", f.ContentType)
+	}
+	if !f.Gzip {
+		return w, func() {}
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	gw := &gzipFlushWriter{gz: gzip.NewWriter(w), w: w}
+	return gw, func() { gw.gz.Close() }
+}
+
+// gzipFlushWriter compresses what is written to it. flushing it flushes the
+// compressed data all the way through to the client.
+type gzipFlushWriter struct {
+	gz *gzip.Writer
+	w  io.Writer
+}
+
+func (g *gzipFlushWriter) Write(p []byte) (int, error) {
+	return g.gz.Write(p)
+}
+
+func (g *gzipFlushWriter) Flush() {
+	g.gz.Flush()
+	if f, ok := g.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// acceptedValue is a value of an Accept style header and its quality
+type acceptedValue struct {
+	value string
+	q     float64
+}
+
+// acceptedValues returns the values of an Accept style header that are
+// acceptable at all, most preferred first. parameters other than the
+// quality are dropped.
+func acceptedValues(header string) []string {
+	var values []acceptedValue
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		value := strings.ToLower(strings.TrimSpace(params[0]))
+		if value == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			values = append(values, acceptedValue{value: value, q: q})
+		}
+	}
+	sort.Stable(byQuality(values))
+
+	accepted := make([]string, 0, len(values))
+	for _, v := range values {
+		accepted = append(accepted, v.value)
+	}
+	return accepted
+}
+
+type byQuality []acceptedValue
+
+func (s byQuality) Len() int           { return len(s) }
+func (s byQuality) Less(i, j int) bool { return s[i].q > s[j].q }
+func (s byQuality) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,84 @@
+package httputils
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestNegotiateLogStreamFormat(t *testing.T) {
+	ctx := context.WithValue(context.Background(), APIVersionKey, "1.31")
+	for _, tc := range []struct {
+		accept, encoding string
+		tty              bool
+		expected         LogStreamFormat
+	}{
+		{"", "", false, LogStreamFormat{Mux: true}},
+		{"", "", true, LogStreamFormat{}},
+		{"*/*", "", false, LogStreamFormat{Mux: true}},
+		{"text/plain", "", false, LogStreamFormat{ContentType: "text/plain"}},
+		{"application/x-ndjson", "gzip", false, LogStreamFormat{JSONLines: true, Gzip: true, ContentType: "application/x-ndjson"}},
+		{"text/plain;q=0.5, application/json", "", false, LogStreamFormat{JSONLines: true, ContentType: "application/json"}},
+		{"application/json;q=0, text/html", "gzip;q=0", false, LogStreamFormat{Mux: true}},
+		// the streams of a container with a TTY can't be told apart
+		{"application/vnd.docker.multiplexed-stream", "", true, LogStreamFormat{}},
+		{"text/plain", "deflate, gzip", false, LogStreamFormat{Gzip: true, ContentType: "text/plain"}},
+		// the default format is never compressed, as clients send
+		// Accept-Encoding without expecting that
+		{"", "gzip", false, LogStreamFormat{Mux: true}},
+		{"application/vnd.docker.multiplexed-stream", "deflate, gzip", false, LogStreamFormat{Mux: true, ContentType: "application/vnd.docker.multiplexed-stream"}},
+		{"application/vnd.docker.raw-stream", "gzip", true, LogStreamFormat{ContentType: "application/vnd.docker.raw-stream"}},
+	} {
+		r, err := http.NewRequest("GET", "/containers/foo/logs", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Accept", tc.accept)
+		r.Header.Set("Accept-Encoding", tc.encoding)
+		if f := NegotiateLogStreamFormat(ctx, r, tc.tty); f != tc.expected {
+			t.Fatalf("accept %q, encoding %q, tty %v: expected %+v, got %+v", tc.accept, tc.encoding, tc.tty, tc.expected, f)
+		}
+	}
+
+	// older clients always get the default format
+	ctx = context.WithValue(context.Background(), APIVersionKey, "1.30")
+	r, err := http.NewRequest("GET", "/containers/foo/logs", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Accept", "application/x-ndjson")
+	r.Header.Set("Accept-Encoding", "gzip")
+	if f := NegotiateLogStreamFormat(ctx, r, false); f != (LogStreamFormat{Mux: true}) {
+		t.Fatalf("expected the default format for API version 1.30, got %+v", f)
+	}
+}
+
+func TestLogStreamFormatGzip(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w, done := LogStreamFormat{Gzip: true, ContentType: "text/plain"}.ResponseWriter(rec)
+	w.Write([]byte("hello\n"))
+	w.(http.Flusher).Flush()
+	if !rec.Flushed {
+		t.Fatal("expected flushing to reach the response")
+	}
+	done()
+
+	if rec.Header().Get("Content-Encoding") != "gzip" || rec.Header().Get("Content-Type") != "text/plain" {
+		t.Fatalf("unexpected headers %v", rec.Header())
+	}
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "hello\n" {
+		t.Fatalf("unexpected body %q", out)
+	}
+}
@@ -1,15 +1,20 @@
 package httputils
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
+	"regexp"
 	"sort"
 	"strings"
+	"unicode/utf8"
 
 	"golang.org/x/net/context"
 
-	"github.com/docker/docker/api/types"
+	"github.com/Sirupsen/logrus"
 	"github.com/docker/docker/api/types/backend"
 	"github.com/docker/docker/pkg/ioutils"
 	"github.com/docker/docker/pkg/jsonlog"
@@ -18,11 +23,37 @@ import (
 
 // WriteLogStream writes an encoded byte stream of log messages from the
 // messages channel, multiplexing them with a stdcopy.Writer if mux is true
-func WriteLogStream(ctx context.Context, w io.Writer, msgs <-chan *backend.LogMessage, config *types.ContainerLogsOptions, mux bool) {
+func WriteLogStream(ctx context.Context, w io.Writer, msgs <-chan *backend.LogMessage, config *backend.ContainerLogsConfig, mux bool) {
+	WriteLogStreamWithResult(ctx, w, msgs, config, mux)
+}
+
+// WriteLogStreamWithResult is WriteLogStream, but it returns why the stream
+// ended: nil if the messages channel was closed, the context's error if it
+// was done first, the error of the last message if the stream ended on an
+// error, or the error writing a message to w. Message errors are written to
+// the stream as well.
+//
+// If the config sets a rotation size or interval, w must be a RotatingWriter,
+// and it is rotated between lines as the config says.
+func WriteLogStreamWithResult(ctx context.Context, w io.Writer, msgs <-chan *backend.LogMessage, config *backend.ContainerLogsConfig, mux bool) error {
+	var rotating RotatingWriter
+	if config.RotateSize > 0 || config.RotateInterval > 0 {
+		var ok bool
+		if rotating, ok = w.(RotatingWriter); !ok {
+			return errors.New("log rotation needs a writer that can be rotated")
+		}
+	}
+	var rot *rotator
+	if rotating != nil {
+		rot = newRotator(w, rotating, config.RotateSize, config.RotateInterval)
+		w = rot
+	}
 	wf := ioutils.NewWriteFlusher(w)
 	defer wf.Close()
 
-	wf.Flush()
+	if !config.SkipInitialFlush {
+		wf.Flush()
+	}
 
 	// this might seem like doing below is clear:
 	//   var outStream io.Writer = wf
@@ -34,61 +65,439 @@ func WriteLogStream(ctx context.Context, w io.Writer, msgs <-chan *backend.LogMe
 	outStream = wf
 	errStream := outStream
 	sysErrStream := errStream
-	if mux {
+	if mux && !config.JSONLines {
 		sysErrStream = stdcopy.NewStdWriter(outStream, stdcopy.Systemerr)
 		errStream = stdcopy.NewStdWriter(outStream, stdcopy.Stderr)
 		outStream = stdcopy.NewStdWriter(outStream, stdcopy.Stdout)
 	}
 
+	var embeddedTimestamp *regexp.Regexp
+	if config.StripEmbeddedTimestamp != "" {
+		// anchor the pattern, so that we only ever strip from the start
+		var err error
+		embeddedTimestamp, err = regexp.Compile("^(?:" + config.StripEmbeddedTimestamp + ")")
+		if err != nil {
+			err = fmt.Errorf("invalid embedded timestamp pattern: %v", err)
+			writeLogStreamError(sysErrStream, err, config.JSONLines)
+			return err
+		}
+	}
+
+	// if we're only interested in the last few lines of a stream that ends,
+	// hold them back in a ring and write them out when the stream does end
+	var tail *tailRing
+	if config.TailBuffer > 0 && !config.Follow {
+		tail = newTailRing(config.TailBuffer)
+	}
+
+	// sources we've already warned about not being mapped to a stream
+	var warned map[string]bool
+	if config.WarnUnmappedSources {
+		warned = make(map[string]bool)
+	}
+
+	// the error of the last message, if it had one. the sender closes the
+	// channel after an error, so this is what the stream ended on
+	var lastErr error
 	for {
-		msg, ok := <-msgs
+		var (
+			msg *backend.LogMessage
+			ok  bool
+		)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok = <-msgs:
+		}
 		if !ok {
-			return
+			if tail != nil {
+				if err := tail.flush(rot); err != nil {
+					return err
+				}
+			}
+			return lastErr
 		}
 		// check if the message contains an error. if so, write that error
 		// and exit
 		if msg.Err != nil {
-			fmt.Fprintf(sysErrStream, "Error grabbing logs: %v\n", msg.Err)
+			writeLogStreamError(sysErrStream, msg.Err, config.JSONLines)
+			lastErr = msg.Err
 			continue
 		}
+		lastErr = nil
 		logLine := msg.Line
-		if config.Details {
-			logLine = append([]byte(stringAttrs(msg.Attrs)+" "), logLine...)
+		if embeddedTimestamp != nil {
+			if loc := embeddedTimestamp.FindIndex(logLine); loc != nil {
+				logLine = bytes.TrimLeft(logLine[loc[1]:], " \t")
+			}
+		}
+		if config.Details && !config.JSONLines {
+			attrs := detailAttrs(msg, config)
+			details := stringAttrs(attrs, config.PinnedDetailKeys)
+			if config.DetailsJSON {
+				details = jsonAttrs(attrs, config.PinnedDetailKeys)
+			}
+			logLine = append([]byte(details+" "), logLine...)
 		}
-		if config.Timestamps {
+		if config.Timestamps && !config.JSONLines {
 			// TODO(dperny) the format is defined in
 			// daemon/logger/logger.go as logger.TimeFormat. importing
 			// logger is verboten (not part of backend) so idk if just
 			// importing the same thing from jsonlog is good enough
 			logLine = append([]byte(msg.Timestamp.Format(jsonlog.RFC3339NanoFixed)+" "), logLine...)
 		}
-		if msg.Source == "stdout" && config.ShowStdout {
-			outStream.Write(logLine)
+		if config.Sanitize {
+			logLine = sanitizeLine(logLine)
+		}
+		if config.LineEndings != "" {
+			logLine = normalizeLineEnding(logLine, config.LineEndings)
+		}
+		if config.JSONLines {
+			logLine = jsonLine(msg, logLine, config)
+		}
+		var stream io.Writer
+		switch sourceStream(config, msg.Source, warned) {
+		case "stdout":
+			if config.ShowStdout {
+				stream = outStream
+			}
+		case "stderr":
+			if config.ShowStderr {
+				stream = errStream
+			}
+		}
+		if stream == nil {
+			continue
+		}
+		if tail != nil {
+			// messages read back from files don't keep the partial flag,
+			// but a partial line is one without a newline
+			partial := msg.Partial || !bytes.HasSuffix(msg.Line, []byte("\n"))
+			tail.add(msg.Source, stream, logLine, partial)
+			continue
+		}
+		if err := rot.maybeRotate(); err != nil {
+			return err
+		}
+		if _, err := stream.Write(logLine); err != nil {
+			return err
 		}
-		if msg.Source == "stderr" && config.ShowStderr {
-			errStream.Write(logLine)
+	}
+}
+
+// writeLogStreamError writes an error that ended the stream. in JSON lines
+// mode it is written as an object with just an "error" field, so that every
+// line of the stream is still JSON
+func writeLogStreamError(w io.Writer, err error, jsonLines bool) {
+	message := fmt.Sprintf("Error grabbing logs: %v", err)
+	if !jsonLines {
+		fmt.Fprintln(w, message)
+		return
+	}
+	line, _ := json.Marshal(struct {
+		Error string `json:"error"`
+	}{message})
+	w.Write(append(line, '\n'))
+}
+
+// jsonLine encodes the message with the given line in the format of the
+// json-file log driver, followed by a newline
+func jsonLine(msg *backend.LogMessage, line []byte, config *backend.ContainerLogsConfig) []byte {
+	// neither a time nor a map of strings can fail to marshal
+	created, _ := jsonlog.FastTimeMarshalJSON(msg.Timestamp)
+	l := &jsonlog.JSONLogs{
+		Log:     line,
+		Stream:  msg.Source,
+		Created: created,
+	}
+	if config.Details {
+		if attrs := detailAttrs(msg, config); len(attrs) > 0 {
+			l.RawAttrs = []byte(jsonAttrs(attrs, config.PinnedDetailKeys))
 		}
 	}
+	var buf bytes.Buffer
+	l.MarshalJSONBuf(&buf)
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+// sourceStream returns the name of the stream that messages from the source
+// are written to, or "" if they are dropped. if warned is not nil, a warning
+// is logged the first time a source without a mapping is seen.
+func sourceStream(config *backend.ContainerLogsConfig, source string, warned map[string]bool) string {
+	if config.SourceStreams == nil {
+		if source == "stdout" || source == "stderr" {
+			return source
+		}
+		return ""
+	}
+	stream, ok := config.SourceStreams[source]
+	if !ok && warned != nil && !warned[source] {
+		warned[source] = true
+		logrus.Warnf("Dropping log messages from source %q, which is not mapped to a stream", source)
+	}
+	return stream
+}
+
+// sanitizeLine returns the line with invalid UTF-8 sequences replaced by the
+// unicode replacement character and NUL bytes removed. if there is nothing to
+// replace, the line is returned as is.
+func sanitizeLine(line []byte) []byte {
+	if utf8.Valid(line) && bytes.IndexByte(line, 0) < 0 {
+		return line
+	}
+	sanitized := make([]byte, 0, len(line))
+	for len(line) > 0 {
+		r, size := utf8.DecodeRune(line)
+		switch {
+		case r == utf8.RuneError && size == 1:
+			sanitized = append(sanitized, string(utf8.RuneError)...)
+		case r != 0:
+			sanitized = append(sanitized, line[:size]...)
+		}
+		line = line[size:]
+	}
+	return sanitized
+}
+
+// normalizeLineEnding returns the line with its terminator changed to the
+// given style, "lf" or "crlf". a trailing carriage return without a line feed
+// is treated as the end of the line too. lines that are already in the right
+// style are returned as is, otherwise a new slice is returned.
+func normalizeLineEnding(line []byte, style string) []byte {
+	content := line
+	switch {
+	case bytes.HasSuffix(content, []byte("\r\n")):
+		content = content[:len(content)-2]
+	case bytes.HasSuffix(content, []byte("\n")), bytes.HasSuffix(content, []byte("\r")):
+		content = content[:len(content)-1]
+	default:
+		// no terminator, nothing to normalize
+		return line
+	}
+
+	terminator := "\n"
+	if style == "crlf" {
+		terminator = "\r\n"
+	}
+	if len(line)-len(content) == len(terminator) && bytes.HasSuffix(line, []byte(terminator)) {
+		return line
+	}
+	normalized := make([]byte, 0, len(content)+len(terminator))
+	normalized = append(normalized, content...)
+	return append(normalized, terminator...)
+}
+
+// tailLine is a fully formatted log line, its source, and the stream it
+// belongs on. a line split over several messages is kept as one tailLine,
+// with each fragment formatted as it would have been written
+type tailLine struct {
+	source string
+	stream io.Writer
+	line   []byte
+	// partial is true while the line is waiting for more fragments
+	partial bool
 }
 
+// tailRing keeps the last n lines added to it
+type tailRing struct {
+	lines []tailLine
+	// next is the index the next line will be written to
+	next int
+	full bool
+	// open is the index of the unfinished line of each source, if it has
+	// one
+	open map[string]int
+}
+
+func newTailRing(n int) *tailRing {
+	return &tailRing{lines: make([]tailLine, n), open: make(map[string]int)}
+}
+
+// add puts a line into the ring, overwriting the oldest line if the ring is
+// full. if the last line added from the source was partial, the line is
+// added to it instead. the line is copied, because the message it came from
+// may be reused
+func (r *tailRing) add(source string, stream io.Writer, line []byte, partial bool) {
+	if i, ok := r.open[source]; ok {
+		delete(r.open, source)
+		// the unfinished line may have been pushed out of the ring since
+		if l := &r.lines[i]; l.source == source && l.partial {
+			l.line = append(l.line, line...)
+			l.partial = partial
+			if partial {
+				r.open[source] = i
+			}
+			return
+		}
+	}
+	if partial {
+		r.open[source] = r.next
+	}
+	r.lines[r.next] = tailLine{source: source, stream: stream, line: append([]byte(nil), line...), partial: partial}
+	r.next++
+	if r.next == len(r.lines) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// flush writes out every line in the ring, oldest first, stopping at the
+// first error. rot, if not nil, is given the chance to rotate between lines
+func (r *tailRing) flush(rot *rotator) error {
+	start := 0
+	if r.full {
+		start = r.next
+	}
+	for i := 0; i < len(r.lines); i++ {
+		l := r.lines[(start+i)%len(r.lines)]
+		if l.stream == nil {
+			// we've reached the end of a ring that was never filled
+			break
+		}
+		if err := rot.maybeRotate(); err != nil {
+			return err
+		}
+		if _, err := l.stream.Write(l.line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// byKey sorts key=value pairs by key. pairs with the same key are sorted by
+// value, so that the order is always the same
 type byKey []string
 
 func (s byKey) Len() int { return len(s) }
 func (s byKey) Less(i, j int) bool {
-	keyI := strings.Split(s[i], "=")
-	keyJ := strings.Split(s[j], "=")
-	return keyI[0] < keyJ[0]
+	keyI := strings.SplitN(s[i], "=", 2)[0]
+	keyJ := strings.SplitN(s[j], "=", 2)[0]
+	if keyI != keyJ {
+		return keyI < keyJ
+	}
+	return s[i] < s[j]
 }
 func (s byKey) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 }
 
-func stringAttrs(a backend.LogAttributes) string {
-	var ss byKey
+// detailAttrs returns the attributes of the message to write as its details
+func detailAttrs(msg *backend.LogMessage, config *backend.ContainerLogsConfig) backend.LogAttributes {
+	attrs := filterAttrs(msg.Attrs, config.DetailKeys, config.DetailExcludeKeys, config.PinnedDetailKeys)
+	if !config.IncludeSource {
+		return attrs
+	}
+	withSource := make(backend.LogAttributes, len(attrs)+1)
+	for k, v := range attrs {
+		withSource[k] = v
+	}
+	withSource["source"] = msg.Source
+	return withSource
+}
+
+// filterAttrs returns only the attributes with the keys in include, or if
+// include is empty, the attributes without the keys in exclude. attributes
+// with the keys in pinned are always kept. the original attributes are not
+// modified.
+func filterAttrs(a backend.LogAttributes, include, exclude, pinned []string) backend.LogAttributes {
+	if len(include) == 0 && len(exclude) == 0 {
+		return a
+	}
+	filtered := make(backend.LogAttributes)
+	for _, k := range pinned {
+		if v, ok := a[k]; ok {
+			filtered[k] = v
+		}
+	}
+	if len(include) > 0 {
+		for _, k := range include {
+			if v, ok := a[k]; ok {
+				filtered[k] = v
+			}
+		}
+		return filtered
+	}
+
+	excluded := make(map[string]bool, len(exclude))
+	for _, k := range exclude {
+		excluded[k] = true
+	}
+	for k, v := range a {
+		if !excluded[k] {
+			filtered[k] = v
+		}
+	}
+	return filtered
+}
+
+// jsonAttrs encodes the attributes as a compact JSON object, with the pinned
+// keys first, in order, and the rest sorted, so the output is stable. no
+// attributes encodes as {}
+func jsonAttrs(a backend.LogAttributes, pinned []string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range orderedKeys(a, pinned) {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		// strings can not fail to marshal
+		key, _ := json.Marshal(k)
+		value, _ := json.Marshal(a[k])
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
+
+// stringAttrs encodes the attributes as comma separated key=value pairs,
+// with the pinned keys first, in order, and the rest sorted by key. keys and
+// values are url query escaped, so any "=" or "," in them can't be confused
+// with the separators. client.ParseLogDetails is the exact inverse, and the
+// two must be kept in agreement.
+func stringAttrs(a backend.LogAttributes, pinned []string) string {
+	first, seen := pinnedKeys(a, pinned)
+	var ss []string
+	for _, k := range first {
+		ss = append(ss, url.QueryEscape(k)+"="+url.QueryEscape(a[k]))
+	}
+	var rest byKey
 	for k, v := range a {
-		k, v := url.QueryEscape(k), url.QueryEscape(v)
-		ss = append(ss, k+"="+v)
+		if !seen[k] {
+			k, v := url.QueryEscape(k), url.QueryEscape(v)
+			rest = append(rest, k+"="+v)
+		}
+	}
+	sort.Sort(rest)
+	return strings.Join(append(ss, rest...), ",")
+}
+
+// pinnedKeys returns the pinned keys that are in the attributes, in order and
+// without repeats, and the set of them
+func pinnedKeys(a backend.LogAttributes, pinned []string) ([]string, map[string]bool) {
+	var keys []string
+	seen := make(map[string]bool, len(pinned))
+	for _, k := range pinned {
+		if _, ok := a[k]; ok && !seen[k] {
+			keys = append(keys, k)
+			seen[k] = true
+		}
+	}
+	return keys, seen
+}
+
+// orderedKeys returns the pinned keys that are in the attributes, in order,
+// followed by the rest of the keys, sorted
+func orderedKeys(a backend.LogAttributes, pinned []string) []string {
+	keys, seen := pinnedKeys(a, pinned)
+	var rest []string
+	for k := range a {
+		if !seen[k] {
+			rest = append(rest, k)
+		}
 	}
-	sort.Sort(ss)
-	return strings.Join(ss, ",")
+	sort.Strings(rest)
+	return append(keys, rest...)
 }
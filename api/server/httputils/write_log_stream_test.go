@@ -0,0 +1,431 @@
+package httputils
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/backend"
+	"github.com/docker/docker/client"
+)
+
+// writeLogs runs WriteLogStream without muxing over the given messages, and
+// returns everything it wrote
+func writeLogs(config *backend.ContainerLogsConfig, msgs ...*backend.LogMessage) string {
+	c := make(chan *backend.LogMessage, len(msgs))
+	for _, m := range msgs {
+		c <- m
+	}
+	close(c)
+
+	var buf bytes.Buffer
+	WriteLogStream(context.Background(), &buf, c, config, false)
+	return buf.String()
+}
+
+func TestWriteLogStreamDetailsJSON(t *testing.T) {
+	msg := &backend.LogMessage{
+		Line:      []byte("hello\n"),
+		Source:    "stdout",
+		Timestamp: time.Now(),
+		Attrs:     backend.LogAttributes{"b": "x,y", "a": "1=2"},
+	}
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Details: true}, DetailsJSON: true}
+	expected := `{"a":"1=2","b":"x,y"} hello` + "\n"
+	if out := writeLogs(config, msg); out != expected {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+
+	msg.Attrs = nil
+	expected = "{} hello\n"
+	if out := writeLogs(config, msg); out != expected {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+}
+
+func TestWriteLogStreamSanitize(t *testing.T) {
+	msg := &backend.LogMessage{
+		Line:   []byte("a\x00b\xffc\xe2\x82d \xe2\x82\xac\n"),
+		Source: "stdout",
+		Attrs:  backend.LogAttributes{"k": "v"},
+	}
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Details: true}}
+	if out := writeLogs(config, msg); out != "k=v "+string(msg.Line) {
+		t.Fatalf("expected line to be written as is without sanitize, got %q", out)
+	}
+
+	config.Sanitize = true
+	expected := "k=v ab\ufffdc\ufffd\ufffdd \u20ac\n"
+	if out := writeLogs(config, msg); out != expected {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+}
+
+func TestWriteLogStreamStripEmbeddedTimestamp(t *testing.T) {
+	ts := time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC)
+	config := &backend.ContainerLogsConfig{
+		ContainerLogsOptions:   types.ContainerLogsOptions{ShowStdout: true, Timestamps: true},
+		StripEmbeddedTimestamp: `\[\d{2}:\d{2}:\d{2}\]`,
+	}
+	out := writeLogs(config,
+		&backend.LogMessage{Line: []byte("[10:00:00]  hello\n"), Source: "stdout", Timestamp: ts},
+		&backend.LogMessage{Line: []byte("world [10:00:00]\n"), Source: "stdout", Timestamp: ts},
+	)
+	expected := "2017-05-01T10:00:00.000000000Z hello\n2017-05-01T10:00:00.000000000Z world [10:00:00]\n"
+	if out != expected {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+}
+
+func TestWriteLogStreamFilterDetails(t *testing.T) {
+	msg := &backend.LogMessage{
+		Line:   []byte("hello\n"),
+		Source: "stdout",
+		Attrs:  backend.LogAttributes{"a": "1", "b": "2", "c": "3"},
+	}
+	for _, tc := range []struct {
+		include, exclude []string
+		expected         string
+	}{
+		{nil, nil, "a=1,b=2,c=3 hello\n"},
+		{[]string{"c", "a", "missing"}, nil, "a=1,c=3 hello\n"},
+		{nil, []string{"b", "missing"}, "a=1,c=3 hello\n"},
+	} {
+		config := &backend.ContainerLogsConfig{
+			ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Details: true},
+			DetailKeys:           tc.include,
+			DetailExcludeKeys:    tc.exclude,
+		}
+		if out := writeLogs(config, msg); out != tc.expected {
+			t.Fatalf("include %v, exclude %v: expected %q, got %q", tc.include, tc.exclude, tc.expected, out)
+		}
+	}
+	if len(msg.Attrs) != 3 {
+		t.Fatalf("expected message attributes to be left alone, got %v", msg.Attrs)
+	}
+}
+
+func TestWriteLogStreamSourceStreams(t *testing.T) {
+	msgs := []*backend.LogMessage{
+		{Line: []byte("out\n"), Source: "stdout"},
+		{Line: []byte("console\n"), Source: "console"},
+		{Line: []byte("app\n"), Source: "app"},
+		{Line: []byte("err\n"), Source: "stderr"},
+	}
+
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true}}
+	if out := writeLogs(config, msgs...); out != "out\nerr\n" {
+		t.Fatalf("expected only stdout and stderr by default, got %q", out)
+	}
+
+	config.SourceStreams = map[string]string{"console": "stdout", "app": "stderr", "stderr": "stderr"}
+	if out := writeLogs(config, msgs...); out != "console\napp\nerr\n" {
+		t.Fatalf("expected mapped sources only, got %q", out)
+	}
+
+	config.ShowStderr = false
+	if out := writeLogs(config, msgs...); out != "console\n" {
+		t.Fatalf("expected sources mapped to stderr to be hidden, got %q", out)
+	}
+}
+
+func TestNormalizeLineEnding(t *testing.T) {
+	for _, tc := range []struct {
+		line, style, expected string
+	}{
+		{"a\r\n", "lf", "a\n"},
+		{"a\r", "lf", "a\n"},
+		{"a\n", "lf", "a\n"},
+		{"a", "lf", "a"},
+		{"a\n", "crlf", "a\r\n"},
+		{"a\r", "crlf", "a\r\n"},
+		{"a\r\n", "crlf", "a\r\n"},
+		{"a\r\r\n", "lf", "a\r\n"},
+	} {
+		if out := string(normalizeLineEnding([]byte(tc.line), tc.style)); out != tc.expected {
+			t.Fatalf("%q as %s: expected %q, got %q", tc.line, tc.style, tc.expected, out)
+		}
+	}
+}
+
+func TestWriteLogStreamLineEndingsWithTimestamps(t *testing.T) {
+	msg := &backend.LogMessage{
+		Line:      []byte("hello\r\n"),
+		Source:    "stdout",
+		Timestamp: time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC),
+	}
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Timestamps: true}, LineEndings: "lf"}
+	expected := "2017-05-01T10:00:00.000000000Z hello\n"
+	if out := writeLogs(config, msg); out != expected {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+	if string(msg.Line) != "hello\r\n" {
+		t.Fatalf("expected the message to be left alone, got %q", msg.Line)
+	}
+}
+
+func TestWriteLogStreamWithResult(t *testing.T) {
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}}
+
+	msgs := make(chan *backend.LogMessage, 1)
+	msgs <- &backend.LogMessage{Line: []byte("hello\n"), Source: "stdout"}
+	close(msgs)
+	var buf bytes.Buffer
+	if err := WriteLogStreamWithResult(context.Background(), &buf, msgs, config, false); err != nil {
+		t.Fatalf("expected no error when the stream is closed, got %v", err)
+	}
+	if buf.String() != "hello\n" {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+
+	msgs = make(chan *backend.LogMessage, 2)
+	msgs <- &backend.LogMessage{Line: []byte("hello\n"), Source: "stdout"}
+	msgs <- &backend.LogMessage{Err: errors.New("broken")}
+	close(msgs)
+	buf.Reset()
+	if err := WriteLogStreamWithResult(context.Background(), &buf, msgs, config, false); err == nil || err.Error() != "broken" {
+		t.Fatalf("expected the message error, got %v", err)
+	}
+	if buf.String() != "hello\nError grabbing logs: broken\n" {
+		t.Fatalf("unexpected output %q", buf.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := WriteLogStreamWithResult(ctx, &buf, make(chan *backend.LogMessage), config, false); err != context.Canceled {
+		t.Fatalf("expected the context error, got %v", err)
+	}
+}
+
+func TestWriteLogStreamJSONLines(t *testing.T) {
+	msg := &backend.LogMessage{
+		Line:      []byte("hello\n"),
+		Source:    "stderr",
+		Timestamp: time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC),
+		Attrs:     backend.LogAttributes{"a": "1"},
+	}
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStderr: true, JSONLines: true, Timestamps: true}}
+	expected := `{"log":"hello\n","stream":"stderr","time":"2017-05-01T10:00:00Z"}` + "\n"
+	if out := writeLogs(config, msg); out != expected {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+
+	config.Details = true
+	expected = `{"log":"hello\n","stream":"stderr","attrs":{"a":"1"},"time":"2017-05-01T10:00:00Z"}` + "\n"
+	if out := writeLogs(config, msg); out != expected {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+
+	// errors are JSON too
+	msgs := make(chan *backend.LogMessage, 1)
+	msgs <- &backend.LogMessage{Err: errors.New("broken")}
+	close(msgs)
+	var buf bytes.Buffer
+	WriteLogStream(context.Background(), &buf, msgs, config, true)
+	expected = `{"error":"Error grabbing logs: broken"}` + "\n"
+	if buf.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestStringAttrsRoundTrip(t *testing.T) {
+	for _, attrs := range []backend.LogAttributes{
+		{},
+		{"k": "v"},
+		{"a=b": "c=d", "e,f": "g,h", "with space": "and more spaces"},
+		{"=": "=", ",": ",", "%": "%3D", "": "empty key", "empty value": ""},
+		{"unicode ☃": "tab\tnewline\n"},
+	} {
+		details := stringAttrs(attrs, nil)
+		parsed, err := client.ParseLogDetails(details)
+		if err != nil {
+			t.Fatalf("parsing %q from %v: %v", details, attrs, err)
+		}
+		if len(parsed) != len(attrs) {
+			t.Fatalf("expected %v, got %v from %q", attrs, parsed, details)
+		}
+		for k, v := range attrs {
+			if parsed[k] != v {
+				t.Fatalf("expected %v, got %v from %q", attrs, parsed, details)
+			}
+		}
+	}
+}
+
+func TestWriteLogStreamIncludeSource(t *testing.T) {
+	msgs := []*backend.LogMessage{
+		{Line: []byte("out\n"), Source: "stdout", Attrs: backend.LogAttributes{"a": "1"}},
+		{Line: []byte("err\n"), Source: "stderr"},
+	}
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true, Details: true}, IncludeSource: true}
+	expected := "a=1,source=stdout out\nsource=stderr err\n"
+	if out := writeLogs(config, msgs...); out != expected {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+
+	// the source is added even if the other details are filtered out
+	config.DetailKeys = []string{"b"}
+	config.DetailsJSON = true
+	expected = `{"source":"stdout"} out` + "\n" + `{"source":"stderr"} err` + "\n"
+	if out := writeLogs(config, msgs...); out != expected {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+	if _, ok := msgs[0].Attrs["source"]; ok {
+		t.Fatal("expected the message attributes to be left alone")
+	}
+}
+
+// stuckConn is a writer that fails writes after it has taken some number of
+// them, like a connection to a client that stopped reading
+type stuckConn struct {
+	bytes.Buffer
+	writes int
+}
+
+func (c *stuckConn) Write(p []byte) (int, error) {
+	if c.writes == 0 {
+		return 0, errors.New("i/o timeout")
+	}
+	c.writes--
+	return c.Buffer.Write(p)
+}
+
+func TestWriteLogStreamWriteError(t *testing.T) {
+	msgs := make(chan *backend.LogMessage, 2)
+	msgs <- &backend.LogMessage{Line: []byte("one\n"), Source: "stdout"}
+	msgs <- &backend.LogMessage{Line: []byte("two\n"), Source: "stdout"}
+
+	conn := &stuckConn{writes: 1}
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, SkipInitialFlush: true}
+	err := WriteLogStreamWithResult(context.Background(), conn, msgs, config, false)
+	if err == nil || err.Error() != "i/o timeout" {
+		t.Fatalf("expected the write error, got %v", err)
+	}
+	if conn.String() != "one\n" {
+		t.Fatalf("unexpected output %q", conn.String())
+	}
+}
+
+func TestWriteLogStreamPinnedDetailKeys(t *testing.T) {
+	msg := &backend.LogMessage{
+		Line:   []byte("hello\n"),
+		Source: "stdout",
+		Attrs:  backend.LogAttributes{"a": "1", "trace_id": "abc", "z": "2"},
+	}
+	config := &backend.ContainerLogsConfig{
+		ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Details: true},
+		PinnedDetailKeys:     []string{"trace_id", "missing"},
+		DetailExcludeKeys:    []string{"trace_id", "z"},
+	}
+	expected := "trace_id=abc,a=1 hello\n"
+	if out := writeLogs(config, msg); out != expected {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+
+	config.DetailExcludeKeys = nil
+	config.DetailKeys = []string{"z"}
+	config.DetailsJSON = true
+	expected = `{"trace_id":"abc","z":"2"} hello` + "\n"
+	if out := writeLogs(config, msg); out != expected {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+
+	config.DetailKeys = nil
+	config.JSONLines = true
+	expected = `{"log":"hello\n","stream":"stdout","attrs":{"trace_id":"abc","a":"1","z":"2"},"time":"0001-01-01T00:00:00Z"}` + "\n"
+	if out := writeLogs(config, msg); out != expected {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+}
+
+func TestByKeyTies(t *testing.T) {
+	expected := "a=1,a=2,ab=0,b=1"
+	for _, pairs := range [][]string{
+		{"b=1", "a=2", "a=1", "ab=0"},
+		{"a=1", "ab=0", "a=2", "b=1"},
+		{"ab=0", "b=1", "a=2", "a=1"},
+	} {
+		sort.Sort(byKey(pairs))
+		if out := strings.Join(pairs, ","); out != expected {
+			t.Fatalf("expected %q, got %q", expected, out)
+		}
+	}
+}
+
+func TestWriteLogStreamTailBuffer(t *testing.T) {
+	config := &backend.ContainerLogsConfig{
+		ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true},
+		TailBuffer:           2,
+	}
+	out := writeLogs(config,
+		&backend.LogMessage{Line: []byte("a\n"), Source: "stdout"},
+		&backend.LogMessage{Line: []byte("b\n"), Source: "stdout"},
+		&backend.LogMessage{Line: []byte("c\n"), Source: "stdout"},
+	)
+	if out != "b\nc\n" {
+		t.Fatalf("expected the last two lines, got %q", out)
+	}
+
+	// the fragments of a split line take up one line of the buffer, even
+	// with a line of another stream in between
+	out = writeLogs(config,
+		&backend.LogMessage{Line: []byte("a\n"), Source: "stdout"},
+		&backend.LogMessage{Line: []byte("b1 "), Source: "stdout", Partial: true},
+		&backend.LogMessage{Line: []byte("b2 "), Source: "stdout"},
+		&backend.LogMessage{Line: []byte("err\n"), Source: "stderr"},
+		&backend.LogMessage{Line: []byte("b3\n"), Source: "stdout"},
+	)
+	if out != "b1 b2 b3\nerr\n" {
+		t.Fatalf("expected the last two assembled lines, got %q", out)
+	}
+}
+
+// flushCounter counts flushes, and how many there were before the first write
+type flushCounter struct {
+	bytes.Buffer
+	flushes            int
+	flushesBeforeWrite int
+	written            bool
+}
+
+func (f *flushCounter) Write(p []byte) (int, error) {
+	if !f.written {
+		f.written = true
+		f.flushesBeforeWrite = f.flushes
+	}
+	return f.Buffer.Write(p)
+}
+
+func (f *flushCounter) Flush() {
+	f.flushes++
+}
+
+func TestWriteLogStreamSkipInitialFlush(t *testing.T) {
+	for _, tc := range []struct {
+		skip     bool
+		expected int
+	}{
+		{false, 1},
+		{true, 0},
+	} {
+		msgs := make(chan *backend.LogMessage, 1)
+		msgs <- &backend.LogMessage{Line: []byte("hello\n"), Source: "stdout"}
+		close(msgs)
+
+		w := &flushCounter{}
+		config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, SkipInitialFlush: tc.skip}
+		WriteLogStream(context.Background(), w, msgs, config, false)
+		if w.flushesBeforeWrite != tc.expected {
+			t.Fatalf("skip initial flush %v: expected %d flushes before the first message, got %d", tc.skip, tc.expected, w.flushesBeforeWrite)
+		}
+		if w.String() != "hello\n" {
+			t.Fatalf("unexpected output %q", w.String())
+		}
+	}
+}
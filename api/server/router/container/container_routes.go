@@ -91,14 +91,16 @@ func (s *containerRouter) getContainersLogs(ctx context.Context, w http.Response
 	}
 
 	containerName := vars["name"]
-	logsConfig := &types.ContainerLogsOptions{
-		Follow:     httputils.BoolValue(r, "follow"),
-		Timestamps: httputils.BoolValue(r, "timestamps"),
-		Since:      r.Form.Get("since"),
-		Tail:       r.Form.Get("tail"),
-		ShowStdout: stdout,
-		ShowStderr: stderr,
-		Details:    httputils.BoolValue(r, "details"),
+	logsConfig := &backend.ContainerLogsConfig{
+		ContainerLogsOptions: types.ContainerLogsOptions{
+			Follow:     httputils.BoolValue(r, "follow"),
+			Timestamps: httputils.BoolValue(r, "timestamps"),
+			Since:      r.Form.Get("since"),
+			Tail:       r.Form.Get("tail"),
+			ShowStdout: stdout,
+			ShowStderr: stderr,
+			Details:    httputils.BoolValue(r, "details"),
+		},
 	}
 
 	// doesn't matter what version the client is on, we're using this internally only
@@ -113,16 +115,22 @@ func (s *containerRouter) getContainersLogs(ctx context.Context, w http.Response
 		return fmt.Errorf("expected container to be *types.ContainerJSON but got %T", raw)
 	}
 
+	// by default, if has a tty, we're not muxing streams. if it doesn't, we
+	// are. the client can ask for something else with the Accept header.
+	format := httputils.NegotiateLogStreamFormat(ctx, r, container.Config.Tty)
+	logsConfig.JSONLines = format.JSONLines
+
 	msgs, err := s.backend.ContainerLogs(ctx, containerName, logsConfig)
 	if err != nil {
 		return err
 	}
 
-	// if has a tty, we're not muxing streams. if it doesn't, we are. simple.
 	// this is the point of no return for writing a response. once we call
 	// WriteLogStream, the response has been started and errors will be
 	// returned in band by WriteLogStream
-	httputils.WriteLogStream(ctx, w, msgs, logsConfig, !container.Config.Tty)
+	out, done := format.ResponseWriter(w)
+	defer done()
+	httputils.WriteLogStream(ctx, out, msgs, logsConfig, format.Mux)
 	return nil
 }
 
@@ -60,6 +60,6 @@ func (sr *swarmRouter) swarmLogs(ctx context.Context, w http.ResponseWriter, r *
 		return err
 	}
 
-	httputils.WriteLogStream(ctx, w, msgs, logsConfig, !tty)
+	httputils.WriteLogStream(ctx, w, msgs, &backend.ContainerLogsConfig{ContainerLogsOptions: *logsConfig}, !tty)
 	return nil
 }
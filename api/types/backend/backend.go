@@ -26,6 +26,208 @@ type ContainerAttachConfig struct {
 	MuxStreams bool
 }
 
+// ContainerLogsConfig holds the options for reading the logs of a container
+// and writing them out, as used inside the daemon. The embedded
+// ContainerLogsOptions are the ones that can be set through the API; the rest
+// can only be set by code in the daemon.
+type ContainerLogsConfig struct {
+	types.ContainerLogsOptions
+
+	// ReadDeadContainer allows reading whatever logs are left for a
+	// container that is dead or being removed.
+	ReadDeadContainer bool
+
+	// DetailsJSON causes details to be written as a JSON object instead of
+	// the default comma separated list of url query escaped key=value pairs.
+	DetailsJSON bool
+
+	// IncludeSource adds the source of each message, like "stdout" or
+	// "stderr", to its details under the "source" key, in place of any
+	// attribute with that key. It can only be used with Details.
+	IncludeSource bool
+
+	// DetailKeys, if not empty, limits the details written to these keys.
+	DetailKeys []string
+	// DetailExcludeKeys are keys left out of the details. It can not be
+	// used together with DetailKeys.
+	DetailExcludeKeys []string
+	// PinnedDetailKeys are keys that are always in the details when a
+	// message has them, whatever DetailKeys and DetailExcludeKeys say, and
+	// that are written first, in the order given.
+	PinnedDetailKeys []string
+
+	// TailBuffer, if greater than zero, causes the log stream writer to hold
+	// back the last TailBuffer lines it would have written and only write
+	// them once the stream ends. The fragments of a line split over several
+	// messages count as one line. It has no effect when following.
+	TailBuffer int
+
+	// DedupWindow, if greater than zero, is the number of recently sent
+	// messages checked for exact duplicates (same timestamp, source and
+	// line). Duplicates found in the window are dropped from the stream.
+	DedupWindow int
+
+	// Sanitize replaces invalid UTF-8 in log lines with the unicode
+	// replacement character, and removes NUL bytes.
+	Sanitize bool
+
+	// MessageBuffer is the number of messages the log reader may get ahead
+	// of the consumer of the stream. Zero uses a buffer of one message. A
+	// larger buffer keeps a slow consumer from stalling the reader, at the
+	// cost of holding up to that many messages in memory.
+	MessageBuffer int
+
+	// Backpressure, if set, is called with how long the stream was blocked
+	// each time the consumer of the stream was not ready for the next
+	// message. It is called from the goroutine producing the stream, so it
+	// should return quickly.
+	Backpressure func(time.Duration)
+
+	// ReuseMessages lets the log reader reuse the messages it sends once
+	// the consumer of the stream is done with them, which saves allocating
+	// a message for each line. A message received from the stream is only
+	// valid until the next message is received: a consumer that keeps a
+	// message, or any part of it, past that must copy it first. Reused
+	// messages come from a pool used only by log readers, so a consumer
+	// breaking this contract can't affect the logging of a running
+	// container, but it can corrupt the messages sent to other readers.
+	ReuseMessages bool
+
+	// StripEmbeddedTimestamp is a regular expression matching a timestamp
+	// that the program in the container put at the start of its log lines.
+	// If set, a match at the start of a line is removed, along with any
+	// spaces or tabs following it.
+	StripEmbeddedTimestamp string
+
+	// SkipInitialFlush stops the log stream writer from flushing before the
+	// first message is written. By default it flushes right away, which is
+	// how HTTP clients know the stream has started.
+	SkipInitialFlush bool
+
+	// ReadRetries is how many times reading is resumed, from right after
+	// the last message read, when the log driver reports an error that may
+	// be transient. It can not be used together with byte or line ranges,
+	// or TailBytes.
+	ReadRetries int
+
+	// MonotonicTimestamps changes the timestamp of any message that is
+	// older than the message before it to the timestamp of that message, so
+	// that timestamps never go backwards when stdout and stderr are merged.
+	// The original timestamp of a changed message is kept in its
+	// "originalTimestamp" detail. This alters the timestamps shown.
+	MonotonicTimestamps bool
+
+	// StrictFollow causes an error to be returned when following is
+	// requested for a container that is not running, instead of reading the
+	// logs without following them.
+	StrictFollow bool
+
+	// ReportNotices causes messages about the stream itself, like following
+	// not being possible because the container is not running, to be sent
+	// from the LogSourceNotice source before any logs.
+	ReportNotices bool
+
+	// ReportExit causes a followed log stream to end with a message from the
+	// LogSourceExit source, reporting how the container exited.
+	ReportExit bool
+
+	// ReportCursor causes a log stream that ends without error to end with
+	// a message from the LogSourceCursor source, holding a cursor
+	// for the position after the last message read.
+	ReportCursor bool
+	// Cursor resumes reading logs right after the position a previous
+	// stream reported. It can not be used together with Since or Tail.
+	Cursor string
+
+	// ByteStart and ByteEnd limit reading to the messages that lie entirely
+	// within this range of bytes of the raw log files of the log driver,
+	// oldest file first. Partial lines at either end are skipped. A ByteEnd
+	// of 0 means the end of the logs. Only some log drivers support this.
+	ByteStart int64
+	ByteEnd   int64
+
+	// TailBytes, if greater than zero, limits the existing logs read to the
+	// complete messages in roughly the last TailBytes bytes of the log
+	// driver's raw logs. If Tail is also set, whichever gives fewer messages
+	// wins. Only some log drivers support this.
+	TailBytes int64
+
+	// LineStart and LineCount read LineCount messages, starting with the
+	// message at index LineStart of the container's logs, oldest first. A
+	// LineCount of 0 reads to the end of the logs. They can not be used
+	// when following. Only some log drivers support this.
+	LineStart int64
+	LineCount int64
+
+	// Windows, if not empty, limits the stream to messages within any of
+	// these time windows. It can not be used together with Since or Cursor.
+	Windows []LogTimeWindow
+
+	// SourceSince sets a separate Since, in the same format, for the
+	// messages of some sources, like "stderr". Messages from other sources
+	// are read from Since. It can not be used together with Cursor or
+	// Windows.
+	SourceSince map[string]string
+
+	// TimeLayouts are extra layouts, as taken by time.Parse, accepted for
+	// Since, SourceSince and the times of Windows. They are tried in order
+	// before the default format of Since.
+	TimeLayouts []string
+
+	// SourceStreams, if not nil, maps the sources of log messages to the
+	// stream ("stdout" or "stderr") they are written to. Messages from a
+	// source mapped to "", or not in the map at all, are dropped. A nil map
+	// writes stdout messages to stdout and stderr messages to stderr.
+	SourceStreams map[string]string
+	// WarnUnmappedSources logs a warning the first time a message from a
+	// source that is not in SourceStreams is dropped.
+	WarnUnmappedSources bool
+
+	// RotateSize and RotateInterval, if greater than zero, rotate the
+	// writer a log stream is written to once it has been written that many
+	// bytes, or has been written to for that long. Rotation only happens
+	// between lines, and needs a writer that can be rotated, like an
+	// httputils.RotatingWriter.
+	RotateSize     int64
+	RotateInterval time.Duration
+
+	// ErrorsOnly shows all of stderr, but only the lines of stdout that
+	// match ErrorPattern. It turns on ShowStdout and ShowStderr.
+	ErrorsOnly bool
+	// ErrorPattern is the regular expression used by ErrorsOnly. If empty,
+	// it defaults to matching the words error, fatal, panic, exception,
+	// fail, failed and failure, ignoring case.
+	ErrorPattern string
+
+	// DropPartialMetadata clears the partial flag of the messages sent, for
+	// consumers that don't put split lines back together. The messages of a
+	// split line are still sent one by one, but can no longer be told apart
+	// from whole lines, other than by not ending with a newline.
+	DropPartialMetadata bool
+
+	// StripANSI removes ANSI escape sequences, like colors and cursor
+	// movement, from log lines.
+	StripANSI bool
+
+	// StopOnMatch is a regular expression that ends the stream once a log
+	// line matches it. The matching line is the last one sent.
+	StopOnMatch string
+
+	// LineEndings normalizes the terminator of each log line: "lf" ends
+	// lines with a line feed alone, removing any carriage return before it,
+	// and "crlf" ends them with a carriage return and line feed. Empty
+	// leaves lines as they are.
+	LineEndings string
+}
+
+// LogTimeWindow is a period of time to read logs from. Since and Until are
+// timestamps in the same format as ContainerLogsOptions.Since. An empty
+// Until leaves the window open ended.
+type LogTimeWindow struct {
+	Since string
+	Until string
+}
+
 // LogMessage is datastructure that represents piece of output produced by some
 // container.  The Line member is a slice of an array whose contents can be
 // changed after a log driver's Log() method returns.
@@ -44,10 +246,40 @@ type LogMessage struct {
 	Err error
 }
 
+// LogSourceExit is the Source of the message sent at the end of a followed
+// log stream to report the exit of the container, when that is requested.
+// Its Attrs hold the "exitCode", and if the container was killed by a
+// signal, the "signal" number.
+const LogSourceExit = "exit"
+
+// LogSourceCursor is the Source of the message sent at the end of a log
+// stream to report the position reading stopped at, when that is requested.
+// Its Attrs hold the opaque "cursor" to resume reading from.
+const LogSourceCursor = "cursor"
+
+// LogSourceNotice is the Source of messages about the log stream itself,
+// rather than from the container, like a notice that following was not
+// possible. The Line is meant to be read by people, and the Attrs hold the
+// "reason" in a form meant for programs.
+const LogSourceNotice = "notice"
+
 // LogAttributes is used to hold the extra attributes available in the log message
 // Primarily used for converting the map type to string and sorting.
 type LogAttributes map[string]string
 
+// LogCapabilities describes which parts of a logs request the log driver of a
+// container can currently honor.
+type LogCapabilities struct {
+	// ReadLogs is true if the logs can be read back at all
+	ReadLogs bool
+	// Follow is true if new messages can be streamed as they are logged
+	Follow bool
+	// Tail is true if reading can be limited to the last lines of the log
+	Tail bool
+	// Since is true if reading can be limited to messages after a time
+	Since bool
+}
+
 // LogSelector is a list of services and tasks that should be returned as part
 // of a log stream. It is similar to swarmapi.LogSelector, with the difference
 // that the names don't have to be resolved to IDs; this is mostly to avoid
@@ -78,6 +78,12 @@ type ContainerLogsOptions struct {
 	Follow     bool
 	Tail       string
 	Details    bool
+
+	// JSONLines writes each message as a JSON object on its own line, in
+	// the format the json-file log driver uses, instead of as a raw line.
+	// Details, if requested, and timestamps are always included as fields
+	// of the object, and the streams are never multiplexed.
+	JSONLines bool
 }
 
 // ContainerRemoveOptions holds parameters to remove containers.
@@ -276,6 +276,10 @@ const (
 type LogConfig struct {
 	Type   string
 	Config map[string]string
+	// Secondary holds the configuration of additional log drivers that
+	// receive a copy of every message. Logs are only ever read back from
+	// the driver in Type.
+	Secondary []LogConfig `json:",omitempty"`
 }
 
 // Resources contains container's resources (cgroups config, ulimits...)
@@ -44,7 +44,15 @@ func (cli *Client) ContainerLogs(ctx context.Context, container string, options
 	}
 	query.Set("tail", options.Tail)
 
-	resp, err := cli.get(ctx, "/containers/"+container+"/logs", query, nil)
+	var headers map[string][]string
+	if options.JSONLines {
+		if err := cli.NewVersionError("1.31", "logs as JSON lines"); err != nil {
+			return nil, err
+		}
+		headers = map[string][]string{"Accept": {"application/x-ndjson"}}
+	}
+
+	resp, err := cli.get(ctx, "/containers/"+container+"/logs", query, headers)
 	if err != nil {
 		return nil, err
 	}
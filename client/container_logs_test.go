@@ -116,6 +116,35 @@ func TestContainerLogs(t *testing.T) {
 	}
 }
 
+func TestContainerLogsJSONLines(t *testing.T) {
+	client := &Client{
+		version: "1.30",
+		client:  newMockClient(func(r *http.Request) (*http.Response, error) { return nil, nil }),
+	}
+	_, err := client.ContainerLogs(context.Background(), "container_id", types.ContainerLogsOptions{JSONLines: true})
+	if err == nil || !strings.Contains(err.Error(), "requires API version 1.31") {
+		t.Fatalf("expected a version error, got %v", err)
+	}
+
+	client = &Client{
+		version: "1.31",
+		client: newMockClient(func(r *http.Request) (*http.Response, error) {
+			if accept := r.Header.Get("Accept"); accept != "application/x-ndjson" {
+				return nil, fmt.Errorf("expected JSON lines to be asked for, got Accept %q", accept)
+			}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+			}, nil
+		}),
+	}
+	body, err := client.ContainerLogs(context.Background(), "container_id", types.ContainerLogsOptions{JSONLines: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body.Close()
+}
+
 func ExampleClient_ContainerLogs_withTimeout() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -1,14 +1,21 @@
 package client
 
 // parse_logs.go contains utility helpers for getting information out of docker
-// log lines. really, it only contains ParseDetails right now. maybe in the
-// future there will be some desire to parse log messages back into a struct?
-// that would go here if we did
+// log lines and streams: ParseLogDetails for the details of a single line, and
+// LogStreamDecoder for turning a whole log stream back into messages.
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
 	"net/url"
 	"strings"
+	"time"
 
+	"github.com/docker/docker/api/types"
 	"github.com/pkg/errors"
 )
 
@@ -16,9 +23,24 @@ import (
 // "k=v,l=w", where the keys and values are url query escaped, and each pair
 // is separated by a comma, returns a map. returns an error if the details
 // string is not in a valid format
+// details written as a JSON object (like {"k":"v","l":"w"}) are also
+// accepted. an escaped key can never start with "{", so the two forms can't
+// be confused.
+// empty details, which is how no attributes are written, give an empty map.
 // the exact form of details encoding is implemented in
-// api/server/httputils/write_log_stream.go
+// api/server/httputils/write_log_stream.go, and ParseLogDetails is its exact
+// inverse.
 func ParseLogDetails(details string) (map[string]string, error) {
+	if details == "" {
+		return map[string]string{}, nil
+	}
+	if strings.HasPrefix(details, "{") {
+		var detailsMap map[string]string
+		if err := json.Unmarshal([]byte(details), &detailsMap); err != nil {
+			return nil, errors.Wrap(err, "invalid details format")
+		}
+		return detailsMap, nil
+	}
 	pairs := strings.Split(details, ",")
 	detailsMap := make(map[string]string, len(pairs))
 	for _, pair := range pairs {
@@ -39,3 +61,298 @@ func ParseLogDetails(details string) (map[string]string, error) {
 	}
 	return detailsMap, nil
 }
+
+// LogMessage is a single message decoded from a log stream
+type LogMessage struct {
+	// Source is the stream the message was written to, "stdout" or "stderr"
+	Source string
+	// Timestamp is only set if the stream was requested with timestamps, or
+	// is in the JSON lines format
+	Timestamp time.Time
+	Line      []byte
+	// Details is only set if the stream was requested with details, or is in
+	// the JSON lines format
+	Details map[string]string
+}
+
+// the stream types used in the header of a multiplexed stream frame. these
+// are the same as the ones in pkg/stdcopy, which we avoid importing here.
+const (
+	streamStdin byte = iota
+	streamStdout
+	streamStderr
+	streamSystemerr
+
+	frameHeaderLen = 8
+	frameSizeIndex = 4
+)
+
+type logStreamFormat int
+
+const (
+	logStreamUnknown logStreamFormat = iota
+	// logStreamFramed is the multiplexed format used for containers without
+	// a tty
+	logStreamFramed
+	// logStreamRaw is the plain format used for containers with a tty
+	logStreamRaw
+	// logStreamJSONLines is one JSON object per line, in the same format as
+	// the json-file log driver writes
+	logStreamJSONLines
+)
+
+// jsonLogLine is a line of a JSON lines log stream. it matches jsonlog.JSONLog,
+// except for Error, which is only set on the line the daemon writes when it
+// fails to read the logs
+type jsonLogLine struct {
+	Log     string            `json:"log,omitempty"`
+	Stream  string            `json:"stream,omitempty"`
+	Created time.Time         `json:"time"`
+	Attrs   map[string]string `json:"attrs,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// LogStreamSystemError is an error the daemon reported in a multiplexed log
+// stream, like failing to read the logs. It is distinct from the container
+// writing to stderr.
+type LogStreamSystemError struct {
+	Message string
+}
+
+func (e *LogStreamSystemError) Error() string {
+	return e.Message
+}
+
+// DemuxLogStream copies a multiplexed log stream, writing the stdout and
+// stderr frames to the matching writer. It returns nil once the stream ends.
+// If the daemon reports an error in the stream, copying stops and the error
+// is returned as a *LogStreamSystemError, so that it can be told apart from
+// the container's own output.
+func DemuxLogStream(stdout, stderr io.Writer, src io.Reader) error {
+	for {
+		stream, payload, err := readLogFrame(src)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer
+		switch stream {
+		case streamStdin, streamStdout:
+			w = stdout
+		case streamStderr:
+			w = stderr
+		case streamSystemerr:
+			return &LogStreamSystemError{Message: strings.TrimSpace(string(payload))}
+		default:
+			return errors.Errorf("unexpected stream type %d in log stream", stream)
+		}
+		if _, err := w.Write(payload); err != nil {
+			return err
+		}
+	}
+}
+
+// LogStreamDecoder reads LogMessages from a log stream, like the one returned
+// by ContainerLogs. Streams requested as JSON lines are decoded as such, and
+// whether any other stream is multiplexed is detected from its first bytes.
+type LogStreamDecoder struct {
+	r       *bufio.Reader
+	options types.ContainerLogsOptions
+	format  logStreamFormat
+}
+
+// NewLogStreamDecoder returns a LogStreamDecoder reading from r. The options
+// should be the ones the stream was requested with, so that timestamps and
+// details can be parsed out of each line.
+func NewLogStreamDecoder(r io.Reader, options types.ContainerLogsOptions) *LogStreamDecoder {
+	return &LogStreamDecoder{
+		r:       bufio.NewReader(r),
+		options: options,
+	}
+}
+
+// Decode returns the next message in the stream. It returns io.EOF when the
+// stream has ended. If the daemon reported an error in the stream, it is
+// returned, and decoding can continue.
+func (d *LogStreamDecoder) Decode() (*LogMessage, error) {
+	if d.format == logStreamUnknown {
+		if err := d.sniff(); err != nil {
+			return nil, err
+		}
+	}
+	switch d.format {
+	case logStreamFramed:
+		return d.decodeFrame()
+	case logStreamJSONLines:
+		return d.decodeJSONLine()
+	default:
+		return d.decodeRawLine()
+	}
+}
+
+// sniff figures out the format of the stream. JSON lines can't be told apart
+// from the output of a tty that happens to be JSON, so they are only expected
+// if they were asked for. otherwise, the first bytes tell whether the stream
+// is multiplexed
+func (d *LogStreamDecoder) sniff() error {
+	if d.options.JSONLines {
+		d.format = logStreamJSONLines
+		return nil
+	}
+	first, err := d.r.Peek(1)
+	if len(first) == 0 {
+		return err
+	}
+
+	header, _ := d.r.Peek(frameHeaderLen)
+	if len(header) == frameHeaderLen && header[0] <= streamSystemerr && header[1] == 0 && header[2] == 0 && header[3] == 0 {
+		d.format = logStreamFramed
+		return nil
+	}
+	d.format = logStreamRaw
+	return nil
+}
+
+func (d *LogStreamDecoder) decodeFrame() (*LogMessage, error) {
+	stream, payload, err := readLogFrame(d.r)
+	if err != nil {
+		return nil, err
+	}
+
+	var source string
+	switch stream {
+	case streamStdout:
+		source = "stdout"
+	case streamStderr:
+		source = "stderr"
+	case streamSystemerr:
+		return nil, &LogStreamSystemError{Message: strings.TrimSpace(string(payload))}
+	default:
+		return nil, errors.Errorf("unexpected stream type %d in log stream", stream)
+	}
+	return d.parseLine(source, payload)
+}
+
+// readLogFrame reads a single frame of a multiplexed log stream, returning
+// its stream type and contents
+func readLogFrame(r io.Reader) (byte, []byte, error) {
+	var header [frameHeaderLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, nil, errors.New("log stream ended in the middle of a frame header")
+		}
+		return 0, nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(header[frameSizeIndex:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, errors.Wrap(err, "error reading log stream frame")
+	}
+	return header[0], payload, nil
+}
+
+func (d *LogStreamDecoder) decodeRawLine() (*LogMessage, error) {
+	line, err := d.r.ReadBytes('\n')
+	if len(line) == 0 {
+		return nil, err
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	// a tty only has the one stream
+	return d.parseLine("stdout", line)
+}
+
+func (d *LogStreamDecoder) decodeJSONLine() (*LogMessage, error) {
+	for {
+		line, err := d.r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) == 0 {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		var l jsonLogLine
+		if err := json.Unmarshal(line, &l); err != nil {
+			return nil, errors.Wrap(err, "invalid JSON log line")
+		}
+		if l.Error != "" {
+			return nil, &LogStreamSystemError{Message: l.Error}
+		}
+		return &LogMessage{
+			Source:    l.Stream,
+			Timestamp: l.Created,
+			Line:      []byte(l.Log),
+			Details:   l.Attrs,
+		}, nil
+	}
+}
+
+// parseLine splits the timestamp and details, if they were requested, off of
+// the front of a line. they are written in the order timestamp, details, line
+func (d *LogStreamDecoder) parseLine(source string, line []byte) (*LogMessage, error) {
+	m := &LogMessage{Source: source}
+	if d.options.Timestamps {
+		field, rest, err := cutLogField(line)
+		if err != nil {
+			return nil, err
+		}
+		m.Timestamp, err = time.Parse(time.RFC3339Nano, field)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid log timestamp")
+		}
+		line = rest
+	}
+	if d.options.Details {
+		field, rest, err := cutLogDetails(line)
+		if err != nil {
+			return nil, err
+		}
+		m.Details, err = ParseLogDetails(field)
+		if err != nil {
+			return nil, err
+		}
+		line = rest
+	}
+	m.Line = line
+	return m, nil
+}
+
+// cutLogDetails returns the details at the front of the line, and the part of
+// the line after them. details in JSON can contain spaces, so they run to the
+// end of the JSON object rather than to the first space. the other format
+// escapes braces, so it never starts with one
+func cutLogDetails(line []byte) (string, []byte, error) {
+	if !bytes.HasPrefix(line, []byte("{")) {
+		return cutLogField(line)
+	}
+	r := bytes.NewReader(line)
+	dec := json.NewDecoder(r)
+	var details json.RawMessage
+	if err := dec.Decode(&details); err != nil {
+		return "", nil, errors.Wrap(err, "invalid details format")
+	}
+	// the decoder reads ahead, so the end of the object is what it has read
+	// from the line, less what it has buffered and not used
+	buffered, _ := ioutil.ReadAll(dec.Buffered())
+	end := len(line) - r.Len() - len(buffered)
+	if end >= len(line) || line[end] != ' ' {
+		return "", nil, errors.New("log line is missing a field")
+	}
+	return string(line[:end]), line[end+1:], nil
+}
+
+// cutLogField returns the part of the line before the first space, and the
+// part after it
+func cutLogField(line []byte) (string, []byte, error) {
+	i := bytes.IndexByte(line, ' ')
+	if i < 0 {
+		return "", nil, errors.New("log line is missing a field")
+	}
+	return string(line[:i]), line[i+1:], nil
+}
@@ -1,9 +1,15 @@
 package client
 
 import (
+	"bytes"
+	"io"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/pkg/errors"
 )
 
@@ -19,6 +25,10 @@ func TestParseLogDetails(t *testing.T) {
 		{"key=,=nothing", map[string]string{"key": "", "": "nothing"}, nil},
 		{"=", map[string]string{"": ""}, nil},
 		{"errors", nil, errors.New("invalid details format")},
+		{"", map[string]string{}, nil},
+		{`{"key":"value"}`, map[string]string{"key": "value"}, nil},
+		{`{"key with spaces":"value=equals","asdf,":""}`, map[string]string{"key with spaces": "value=equals", "asdf,": ""}, nil},
+		{"{}", map[string]string{}, nil},
 	}
 	for _, tc := range testCases {
 		tc := tc // capture range variable
@@ -34,3 +44,176 @@ func TestParseLogDetails(t *testing.T) {
 		})
 	}
 }
+
+func TestParseLogDetailsInvalidJSON(t *testing.T) {
+	for _, details := range []string{`{"key":1}`, "{"} {
+		if _, err := ParseLogDetails(details); err == nil {
+			t.Fatalf("expected error parsing %q", details)
+		}
+	}
+}
+
+func decodeAll(t *testing.T, d *LogStreamDecoder) []*LogMessage {
+	var msgs []*LogMessage
+	for {
+		m, err := d.Decode()
+		if err == io.EOF {
+			return msgs
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, m)
+	}
+}
+
+func TestLogStreamDecoderFramed(t *testing.T) {
+	var buf bytes.Buffer
+	stdcopy.NewStdWriter(&buf, stdcopy.Stdout).Write([]byte("2017-05-01T10:00:00.000000001Z a=b hello\n"))
+	stdcopy.NewStdWriter(&buf, stdcopy.Stderr).Write([]byte("2017-05-01T10:00:00.000000002Z  oops\n"))
+	stdcopy.NewStdWriter(&buf, stdcopy.Systemerr).Write([]byte("Error grabbing logs: bad\n"))
+
+	d := NewLogStreamDecoder(&buf, types.ContainerLogsOptions{Timestamps: true, Details: true})
+	m, err := d.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &LogMessage{
+		Source:    "stdout",
+		Timestamp: time.Date(2017, 5, 1, 10, 0, 0, 1, time.UTC),
+		Line:      []byte("hello\n"),
+		Details:   map[string]string{"a": "b"},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, m)
+	}
+
+	m, err = d.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Source != "stderr" || string(m.Line) != "oops\n" || len(m.Details) != 0 {
+		t.Fatalf("unexpected message %+v", m)
+	}
+
+	if _, err := d.Decode(); err == nil || err.Error() != "Error grabbing logs: bad" {
+		t.Fatalf("expected system error, got %v", err)
+	} else if _, ok := err.(*LogStreamSystemError); !ok {
+		t.Fatalf("expected *LogStreamSystemError, got %T", err)
+	}
+	if _, err := d.Decode(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestLogStreamDecoderRaw(t *testing.T) {
+	d := NewLogStreamDecoder(strings.NewReader("hello\nworld"), types.ContainerLogsOptions{})
+	msgs := decodeAll(t, d)
+	if len(msgs) != 2 || string(msgs[0].Line) != "hello\n" || string(msgs[1].Line) != "world" {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+	if msgs[0].Source != "stdout" {
+		t.Fatalf("expected raw stream to be stdout, got %s", msgs[0].Source)
+	}
+}
+
+func TestLogStreamDecoderJSONLines(t *testing.T) {
+	stream := `{"log":"hello\n","stream":"stderr","time":"2017-05-01T10:00:00.000000001Z","attrs":{"a":"b"}}
+{"log":"world\n","stream":"stdout","time":"2017-05-01T10:00:00.000000002Z"}
+`
+	d := NewLogStreamDecoder(strings.NewReader(stream+`{"error":"Error grabbing logs: bad"}`+"\n"), types.ContainerLogsOptions{JSONLines: true})
+	var msgs []*LogMessage
+	for i := 0; i < 2; i++ {
+		m, err := d.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, m)
+	}
+	if _, err := d.Decode(); err == nil || err.Error() != "Error grabbing logs: bad" {
+		t.Fatalf("expected system error, got %v", err)
+	} else if _, ok := err.(*LogStreamSystemError); !ok {
+		t.Fatalf("expected *LogStreamSystemError, got %T", err)
+	}
+	if _, err := d.Decode(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+	expected := []*LogMessage{
+		{
+			Source:    "stderr",
+			Timestamp: time.Date(2017, 5, 1, 10, 0, 0, 1, time.UTC),
+			Line:      []byte("hello\n"),
+			Details:   map[string]string{"a": "b"},
+		},
+		{
+			Source:    "stdout",
+			Timestamp: time.Date(2017, 5, 1, 10, 0, 0, 2, time.UTC),
+			Line:      []byte("world\n"),
+		},
+	}
+	if !reflect.DeepEqual(msgs, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, msgs)
+	}
+}
+
+func TestLogStreamDecoderRawJSON(t *testing.T) {
+	// a tty writing JSON is still a raw stream
+	d := NewLogStreamDecoder(strings.NewReader(`{"level":"info","msg":"hi"}`+"\n"), types.ContainerLogsOptions{})
+	msgs := decodeAll(t, d)
+	if len(msgs) != 1 || string(msgs[0].Line) != `{"level":"info","msg":"hi"}`+"\n" {
+		t.Fatalf("unexpected messages %+v", msgs)
+	}
+}
+
+func TestLogStreamDecoderJSONDetails(t *testing.T) {
+	d := NewLogStreamDecoder(strings.NewReader(`{"k":"a b","{":"}"} hello world`+"\n"), types.ContainerLogsOptions{Details: true})
+	msgs := decodeAll(t, d)
+	expected := []*LogMessage{
+		{
+			Source:  "stdout",
+			Line:    []byte("hello world\n"),
+			Details: map[string]string{"k": "a b", "{": "}"},
+		},
+	}
+	if !reflect.DeepEqual(msgs, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, msgs)
+	}
+
+	d = NewLogStreamDecoder(strings.NewReader(`{"k":"a b"}hello`+"\n"), types.ContainerLogsOptions{Details: true})
+	if _, err := d.Decode(); err == nil {
+		t.Fatal("expected an error for details not followed by a space")
+	}
+}
+
+func TestDemuxLogStream(t *testing.T) {
+	var buf bytes.Buffer
+	stdcopy.NewStdWriter(&buf, stdcopy.Stdout).Write([]byte("hello\n"))
+	stdcopy.NewStdWriter(&buf, stdcopy.Stderr).Write([]byte("oops\n"))
+
+	var stdout, stderr bytes.Buffer
+	if err := DemuxLogStream(&stdout, &stderr, bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "hello\n" || stderr.String() != "oops\n" {
+		t.Fatalf("unexpected output: stdout %q, stderr %q", stdout.String(), stderr.String())
+	}
+
+	stdcopy.NewStdWriter(&buf, stdcopy.Systemerr).Write([]byte("Error grabbing logs: bad\n"))
+	stdcopy.NewStdWriter(&buf, stdcopy.Stdout).Write([]byte("after\n"))
+	stdout.Reset()
+	stderr.Reset()
+	err := DemuxLogStream(&stdout, &stderr, &buf)
+	sysErr, ok := err.(*LogStreamSystemError)
+	if !ok {
+		t.Fatalf("expected *LogStreamSystemError, got %v", err)
+	}
+	if sysErr.Message != "Error grabbing logs: bad" {
+		t.Fatalf("unexpected system error message %q", sysErr.Message)
+	}
+	if stderr.String() != "oops\n" {
+		t.Fatalf("expected system error to be kept out of stderr, got %q", stderr.String())
+	}
+	if stdout.String() != "hello\n" {
+		t.Fatalf("expected copying to stop at the system error, got %q", stdout.String())
+	}
+}
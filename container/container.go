@@ -331,6 +331,41 @@ func (container *Container) CheckpointDir() string {
 // StartLogger starts a new logger driver for the container.
 func (container *Container) StartLogger() (logger.Logger, error) {
 	cfg := container.HostConfig.LogConfig
+	l, err := container.startLogger(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Secondary) == 0 {
+		return l, nil
+	}
+
+	secondaries := make([]logger.Logger, 0, len(cfg.Secondary))
+	for _, secondaryCfg := range cfg.Secondary {
+		sl, err := container.startLogger(secondaryCfg)
+		if err != nil {
+			for _, started := range append(secondaries, l) {
+				if err := started.Close(); err != nil {
+					logrus.Errorf("Error closing logger: %v", err)
+				}
+			}
+			return nil, err
+		}
+		secondaries = append(secondaries, sl)
+	}
+	return logger.NewTeeLogger(l, secondaries...), nil
+}
+
+// StartPrimaryLogger starts only the container's primary logger driver,
+// without its secondary drivers. Reading logs back is only ever done from the
+// primary, so this is all that is needed to read the logs of a container that
+// isn't running.
+func (container *Container) StartPrimaryLogger() (logger.Logger, error) {
+	return container.startLogger(container.HostConfig.LogConfig)
+}
+
+// startLogger starts a single logging driver from the given configuration,
+// ignoring any secondary drivers it has
+func (container *Container) startLogger(cfg containertypes.LogConfig) (logger.Logger, error) {
 	initDriver, err := logger.GetLogDriver(cfg.Type)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get logging factory: %v", err)
@@ -410,14 +410,16 @@ func (c *containerAdapter) deactivateServiceBinding() error {
 }
 
 func (c *containerAdapter) logs(ctx context.Context, options api.LogSubscriptionOptions) (<-chan *backend.LogMessage, error) {
-	apiOptions := &types.ContainerLogsOptions{
-		Follow: options.Follow,
-
-		// Always say yes to Timestamps and Details. we make the decision
-		// of whether to return these to the user or not way higher up the
-		// stack.
-		Timestamps: true,
-		Details:    true,
+	apiOptions := &backend.ContainerLogsConfig{
+		ContainerLogsOptions: types.ContainerLogsOptions{
+			Follow: options.Follow,
+
+			// Always say yes to Timestamps and Details. we make the decision
+			// of whether to return these to the user or not way higher up the
+			// stack.
+			Timestamps: true,
+			Details:    true,
+		},
 	}
 
 	if options.Since != nil {
@@ -519,10 +519,15 @@ func (r *controller) Logs(ctx context.Context, publisher exec.LogPublisher, opti
 			return errors.Wrap(err, "failed to convert timestamp")
 		}
 		var stream api.LogStream
-		if msg.Source == "stdout" {
+		switch msg.Source {
+		case "stdout":
 			stream = api.LogStreamStdout
-		} else if msg.Source == "stderr" {
+		case "stderr":
 			stream = api.LogStreamStderr
+		default:
+			// messages about the stream itself, rather than from the
+			// container, have no place in the task's logs
+			continue
 		}
 
 		// parse the details out of the Attrs map
@@ -0,0 +1,87 @@
+package container
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/backend"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	executorpkg "github.com/docker/docker/daemon/cluster/executor"
+	"github.com/docker/swarmkit/agent/exec"
+	"github.com/docker/swarmkit/api"
+	"golang.org/x/net/context"
+)
+
+// logsBackend is a backend with an exited container, whose logs are the
+// given messages
+type logsBackend struct {
+	executorpkg.Backend
+	msgs   []*backend.LogMessage
+	config *backend.ContainerLogsConfig
+}
+
+func (b *logsBackend) ContainerInspectCurrent(name string, size bool) (*types.ContainerJSON, error) {
+	return &types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{State: &types.ContainerState{Status: "exited"}},
+	}, nil
+}
+
+func (b *logsBackend) SubscribeToEvents(since, until time.Time, filter filters.Args) ([]events.Message, chan interface{}) {
+	return nil, make(chan interface{})
+}
+
+func (b *logsBackend) UnsubscribeFromEvents(listener chan interface{}) {}
+
+func (b *logsBackend) ContainerLogs(ctx context.Context, name string, config *backend.ContainerLogsConfig) (<-chan *backend.LogMessage, error) {
+	b.config = config
+	msgs := make(chan *backend.LogMessage, len(b.msgs))
+	for _, m := range b.msgs {
+		msgs <- m
+	}
+	close(msgs)
+	return msgs, nil
+}
+
+func TestControllerLogsExitedTask(t *testing.T) {
+	b := &logsBackend{msgs: []*backend.LogMessage{
+		{Line: []byte("not running\n"), Source: backend.LogSourceNotice},
+		{Line: []byte("hello\n"), Source: "stdout"},
+		{Line: []byte("oops\n"), Source: "stderr"},
+	}}
+	task := &api.Task{
+		ID: "id",
+		Spec: api.TaskSpec{
+			Runtime: &api.TaskSpec_Container{
+				Container: &api.ContainerSpec{Image: "image_name"},
+			},
+		},
+	}
+	ctlr, err := newController(b, task, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var published []api.LogMessage
+	publisher := exec.LogPublisherFunc(func(ctx context.Context, message api.LogMessage) error {
+		published = append(published, message)
+		return nil
+	})
+	if err := ctlr.Logs(context.Background(), publisher, api.LogSubscriptionOptions{Follow: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if b.config.ReportNotices {
+		t.Fatal("expected service logs not to ask for notices")
+	}
+	if len(published) != 2 {
+		t.Fatalf("expected only the container's output to be published, got %v", published)
+	}
+	if published[0].Stream != api.LogStreamStdout || string(published[0].Data) != "hello\n" {
+		t.Fatalf("unexpected message %+v", published[0])
+	}
+	if published[1].Stream != api.LogStreamStderr || string(published[1].Data) != "oops\n" {
+		t.Fatalf("unexpected message %+v", published[1])
+	}
+}
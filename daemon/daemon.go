@@ -105,6 +105,7 @@ type Daemon struct {
 	PluginStore           *plugin.Store          // todo: remove
 	pluginManager         *plugin.Manager
 	nameIndex             *registrar.Registrar
+	nameHistory           nameHistory
 	linkIndex             *linkIndex
 	containerd            libcontainerd.Client
 	containerdRemote      libcontainerd.Remote
@@ -1051,3 +1051,26 @@ func BenchmarkUnwrapEvents(b *testing.B) {
 		as.Len(res, maximumLogEventsPerPut)
 	}
 }
+
+func TestValidateLogOptsAttributesKey(t *testing.T) {
+	for _, tc := range []struct {
+		cfg map[string]string
+		key string
+	}{
+		{map[string]string{logGroupKey: groupName, logCreateGroupKey: "maybe"}, logCreateGroupKey},
+		{map[string]string{logGroupKey: groupName, regionKey: "us-east-1", "awslogs-colour": "blue"}, "awslogs-colour"},
+		// the group is missing, which no other option is to blame for
+		{map[string]string{regionKey: "us-east-1", logStreamKey: streamName}, ""},
+		// both are fine on their own
+		{map[string]string{logGroupKey: groupName, datetimeFormatKey: "%Y", multilinePatternKey: "^-"}, ""},
+	} {
+		err := logger.ValidateLogOpts(name, tc.cfg)
+		optErr, ok := err.(*logger.LogOptError)
+		if !ok {
+			t.Fatalf("%v: expected a *logger.LogOptError, got %T: %v", tc.cfg, err, err)
+		}
+		if optErr.Key != tc.key || optErr.Value != tc.cfg[tc.key] {
+			t.Fatalf("%v: expected %q to be blamed, got %+v", tc.cfg, tc.key, optErr)
+		}
+	}
+}
@@ -21,6 +21,7 @@ type LogOptValidator func(cfg map[string]string) error
 type logdriverFactory struct {
 	registry     map[string]Creator
 	optValidator map[string]LogOptValidator
+	readable     map[string]bool
 	m            sync.Mutex
 }
 
@@ -40,6 +41,26 @@ func ListDrivers() []string {
 	return factory.list()
 }
 
+func (lf *logdriverFactory) listReadable() []string {
+	lf.m.Lock()
+	ls := make([]string, 0, len(lf.readable))
+	for name := range lf.readable {
+		if _, ok := lf.registry[name]; ok {
+			ls = append(ls, name)
+		}
+	}
+	lf.m.Unlock()
+	sort.Strings(ls)
+	return ls
+}
+
+// ListReadableDrivers gets the names of the registered log drivers whose
+// loggers are LogReaders. Plugins are not included, since whether they can
+// read is only known once they are loaded.
+func ListReadableDrivers() []string {
+	return factory.listReadable()
+}
+
 func (lf *logdriverFactory) register(name string, c Creator) error {
 	if lf.driverRegistered(name) {
 		return fmt.Errorf("logger: log driver named '%s' is already registered", name)
@@ -65,6 +86,12 @@ func (lf *logdriverFactory) driverRegistered(name string) bool {
 	return ok
 }
 
+func (lf *logdriverFactory) registerReadable(name string) {
+	lf.m.Lock()
+	lf.readable[name] = true
+	lf.m.Unlock()
+}
+
 func (lf *logdriverFactory) registerLogOptValidator(name string, l LogOptValidator) error {
 	lf.m.Lock()
 	defer lf.m.Unlock()
@@ -97,7 +124,7 @@ func (lf *logdriverFactory) getLogOptValidator(name string) LogOptValidator {
 	return c
 }
 
-var factory = &logdriverFactory{registry: make(map[string]Creator), optValidator: make(map[string]LogOptValidator)} // global factory instance
+var factory = &logdriverFactory{registry: make(map[string]Creator), optValidator: make(map[string]LogOptValidator), readable: make(map[string]bool)} // global factory instance
 
 // RegisterLogDriver registers the given logging driver builder with given logging
 // driver name.
@@ -105,6 +132,13 @@ func RegisterLogDriver(name string, c Creator) error {
 	return factory.register(name, c)
 }
 
+// RegisterReadableLogDriver records that the loggers created by the given
+// logging driver implement LogReader. Drivers that support reading should
+// register this along with the driver itself.
+func RegisterReadableLogDriver(name string) {
+	factory.registerReadable(name)
+}
+
 // RegisterLogOptValidator registers the logging option validator with
 // the given logging driver name.
 func RegisterLogOptValidator(name string, l LogOptValidator) error {
@@ -124,6 +158,10 @@ var builtInLogOpts = map[string]bool{
 // ValidateLogOpts checks the options for the given log driver. The
 // options supported are specific to the LogDriver implementation.
 func ValidateLogOpts(name string, cfg map[string]string) error {
+	return factory.validateLogOpts(name, cfg)
+}
+
+func (lf *logdriverFactory) validateLogOpts(name string, cfg map[string]string) error {
 	if name == "none" {
 		return nil
 	}
@@ -131,19 +169,19 @@ func ValidateLogOpts(name string, cfg map[string]string) error {
 	switch containertypes.LogMode(cfg["mode"]) {
 	case containertypes.LogModeBlocking, containertypes.LogModeNonBlock, containertypes.LogModeUnset:
 	default:
-		return fmt.Errorf("logger: logging mode not supported: %s", cfg["mode"])
+		return newLogOptError(name, "mode", cfg, fmt.Errorf("logger: logging mode not supported: %s", cfg["mode"]))
 	}
 
 	if s, ok := cfg["max-buffer-size"]; ok {
 		if containertypes.LogMode(cfg["mode"]) != containertypes.LogModeNonBlock {
-			return fmt.Errorf("logger: max-buffer-size option is only supported with 'mode=%s'", containertypes.LogModeNonBlock)
+			return newLogOptError(name, "max-buffer-size", cfg, fmt.Errorf("logger: max-buffer-size option is only supported with 'mode=%s'", containertypes.LogModeNonBlock))
 		}
 		if _, err := units.RAMInBytes(s); err != nil {
-			return errors.Wrap(err, "error parsing option max-buffer-size")
+			return newLogOptError(name, "max-buffer-size", cfg, errors.Wrap(err, "error parsing option max-buffer-size"))
 		}
 	}
 
-	if !factory.driverRegistered(name) {
+	if !lf.driverRegistered(name) {
 		return fmt.Errorf("logger: no log driver named '%s' is registered", name)
 	}
 
@@ -154,9 +192,61 @@ func ValidateLogOpts(name string, cfg map[string]string) error {
 		}
 	}
 
-	validator := factory.getLogOptValidator(name)
-	if validator != nil {
-		return validator(filteredOpts)
+	validator := lf.getLogOptValidator(name)
+	if validator == nil {
+		return nil
+	}
+	if err := validator(filteredOpts); err != nil {
+		return newLogOptError(name, offendingLogOpt(validator, filteredOpts), cfg, err)
 	}
 	return nil
 }
+
+// LogOptError is returned by ValidateLogOpts when the options for a log
+// driver are invalid. Key is empty if the failure could not be attributed to
+// a single option.
+type LogOptError struct {
+	Driver string
+	Key    string
+	Value  string
+	Err    error
+}
+
+func newLogOptError(driver, key string, cfg map[string]string, err error) *LogOptError {
+	return &LogOptError{Driver: driver, Key: key, Value: cfg[key], Err: err}
+}
+
+// Error returns the message of the underlying error, unchanged
+func (e *LogOptError) Error() string {
+	return e.Err.Error()
+}
+
+// IsValidationError marks the error as caused by invalid input, so that the
+// API responds with a 400
+func (e *LogOptError) IsValidationError() bool {
+	return true
+}
+
+// offendingLogOpt returns the option to blame for the validator rejecting
+// cfg: the only option whose removal makes the rest of cfg valid. if there is
+// no such option, or more than one, the failure can't be put down to a single
+// option, and "" is returned.
+func offendingLogOpt(validator LogOptValidator, cfg map[string]string) string {
+	var offending string
+	for k := range cfg {
+		without := make(map[string]string, len(cfg)-1)
+		for other, v := range cfg {
+			if other != k {
+				without[other] = v
+			}
+		}
+		if err := validator(without); err != nil {
+			continue
+		}
+		if offending != "" {
+			return ""
+		}
+		offending = k
+	}
+	return offending
+}
@@ -0,0 +1,77 @@
+package logger
+
+import (
+	"fmt"
+	"testing"
+)
+
+// newTestFactory returns a factory of its own, so that tests don't register
+// drivers with the global one
+func newTestFactory() *logdriverFactory {
+	return &logdriverFactory{registry: make(map[string]Creator), optValidator: make(map[string]LogOptValidator), readable: make(map[string]bool)}
+}
+
+func TestValidateLogOptsAttributesKey(t *testing.T) {
+	const driver = "test-validate-log-opts"
+	lf := newTestFactory()
+	if err := lf.register(driver, func(Info) (Logger, error) { return nil, nil }); err != nil {
+		t.Fatal(err)
+	}
+	err := lf.registerLogOptValidator(driver, func(cfg map[string]string) error {
+		for k := range cfg {
+			if k != "good" && k != "a" && k != "b" {
+				return fmt.Errorf("unknown log opt '%s' for %s log driver", k, driver)
+			}
+		}
+		if cfg["a"] != "" && cfg["b"] != "" {
+			return fmt.Errorf("a and b can not be used together")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lf.validateLogOpts(driver, map[string]string{"good": "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		cfg        map[string]string
+		key, value string
+	}{
+		{map[string]string{"good": "1", "bad": "2"}, "bad", "2"},
+		// neither option is wrong on its own
+		{map[string]string{"a": "1", "b": "2"}, "", ""},
+		{map[string]string{"mode": "sometimes"}, "mode", "sometimes"},
+		{map[string]string{"max-buffer-size": "1m"}, "max-buffer-size", "1m"},
+	} {
+		err := lf.validateLogOpts(driver, tc.cfg)
+		optErr, ok := err.(*LogOptError)
+		if !ok {
+			t.Fatalf("%v: expected a *LogOptError, got %T: %v", tc.cfg, err, err)
+		}
+		if optErr.Driver != driver || optErr.Key != tc.key || optErr.Value != tc.value {
+			t.Fatalf("%v: expected %s=%s to be blamed, got %+v", tc.cfg, tc.key, tc.value, optErr)
+		}
+	}
+}
+
+func TestListReadableDrivers(t *testing.T) {
+	const driver = "test-readable-log-driver"
+	lf := newTestFactory()
+	lf.registerReadable(driver)
+	if readable := lf.listReadable(); len(readable) != 0 {
+		t.Fatalf("expected a driver that is not registered to be left out, got %v", readable)
+	}
+
+	if err := lf.register(driver, func(Info) (Logger, error) { return nil, nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := lf.register("test-unreadable-log-driver", func(Info) (Logger, error) { return nil, nil }); err != nil {
+		t.Fatal(err)
+	}
+	if readable := lf.listReadable(); len(readable) != 1 || readable[0] != driver {
+		t.Fatalf("expected only %s to be listed as readable, got %v", driver, readable)
+	}
+}
@@ -160,6 +160,10 @@ import (
 	"github.com/docker/docker/daemon/logger"
 )
 
+func init() {
+	logger.RegisterReadableLogDriver(name)
+}
+
 func (s *journald) Close() error {
 	s.mu.Lock()
 	s.closed = true
@@ -37,6 +37,7 @@ func init() {
 	if err := logger.RegisterLogOptValidator(Name, ValidateLogOpt); err != nil {
 		logrus.Fatal(err)
 	}
+	logger.RegisterReadableLogDriver(Name)
 }
 
 // New creates new JSONFileLogger which writes to filename passed in
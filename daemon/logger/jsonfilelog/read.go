@@ -1,6 +1,7 @@
 package jsonfilelog
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"errors"
@@ -27,13 +28,23 @@ func decodeLogLine(dec *json.Decoder, l *jsonlog.JSONLog) (*logger.Message, erro
 	if err := dec.Decode(l); err != nil {
 		return nil, err
 	}
-	msg := &logger.Message{
-		Source:    l.Stream,
-		Timestamp: l.Created,
-		Line:      []byte(l.Log),
-		Attrs:     l.Attrs,
-	}
-	return msg, nil
+	return jsonLogToMessage(l), nil
+}
+
+// jsonLogToMessage returns a message from the read message pool holding the
+// log entry, so that readers which put their messages back can reuse them
+func jsonLogToMessage(l *jsonlog.JSONLog) *logger.Message {
+	m := logger.NewReadMessage()
+	m.Source = l.Stream
+	m.Timestamp = l.Created
+	m.Line = append(m.Line, l.Log...)
+	m.Attrs = l.Attrs
+	return m
+}
+
+// ReaderCapabilities implements the logger's CapableLogReader interface
+func (l *JSONFileLogger) ReaderCapabilities() logger.ReaderCapabilities {
+	return logger.ReaderCapabilities{ByteRange: true, TailBytes: true, LineRange: true}
 }
 
 // ReadLogs implements the logger's LogReader interface for the logs
@@ -76,9 +87,23 @@ func (l *JSONFileLogger) readLogs(logWatcher *logger.LogWatcher, config logger.R
 	}
 	defer latestFile.Close()
 
-	if config.Tail != 0 {
+	if config.ByteStart != 0 || config.ByteEnd != 0 {
+		rangeReader := multireader.MultiReadSeeker(append(files, latestFile)...)
+		readByteRange(rangeReader, logWatcher, config.ByteStart, config.ByteEnd, config.Since)
+		// a byte range is a fixed window, it can't be followed
+		config.Follow = false
+	} else if config.LineStart != 0 || config.LineCount != 0 {
+		lineReader := multireader.MultiReadSeeker(append(files, latestFile)...)
+		readLineRange(lineReader, logWatcher, config.LineStart, config.LineCount, config.Since)
+		// like a byte range, a line range is a fixed window
+		config.Follow = false
+	} else if config.Tail != 0 {
 		tailer := multireader.MultiReadSeeker(append(files, latestFile)...)
-		tailFile(tailer, logWatcher, config.Tail, config.Since)
+		if config.TailBytes > 0 {
+			tailBytes(tailer, logWatcher, config.TailBytes, config.Tail, config.Since)
+		} else {
+			tailFile(tailer, logWatcher, config.Tail, config.Since)
+		}
 	}
 
 	// close all the rotated files
@@ -93,7 +118,7 @@ func (l *JSONFileLogger) readLogs(logWatcher *logger.LogWatcher, config logger.R
 		return
 	}
 
-	if config.Tail >= 0 {
+	if config.Tail >= 0 || config.TailBytes > 0 {
 		latestFile.Seek(0, os.SEEK_END)
 	}
 
@@ -143,6 +168,148 @@ func tailFile(f io.ReadSeeker, logWatcher *logger.LogWatcher, tail int, since ti
 	}
 }
 
+// tailBytes sends the complete messages in the last budget bytes of f. if
+// tail is greater than zero and the last tail lines fit in the budget, only
+// those are sent instead.
+func tailBytes(f io.ReadSeeker, logWatcher *logger.LogWatcher, budget int64, tail int, since time.Time) {
+	if tail > 0 {
+		ls, err := tailfile.TailFile(f, tail)
+		if err != nil {
+			logWatcher.Err <- err
+			return
+		}
+		var size int64
+		for _, l := range ls {
+			size += int64(len(l)) + 1
+		}
+		if size <= budget {
+			tailFile(f, logWatcher, tail, since)
+			return
+		}
+	}
+
+	size, err := f.Seek(0, os.SEEK_END)
+	if err != nil {
+		logWatcher.Err <- err
+		return
+	}
+	if size == 0 {
+		return
+	}
+	start := size - budget
+	if start < 0 {
+		start = 0
+	}
+	readByteRange(f, logWatcher, start, 0, since)
+}
+
+// readByteRange sends the messages that lie entirely between the start and
+// end offsets of f. an end of 0 means the end of f. a partial line at either
+// end of the range is skipped.
+func readByteRange(f io.ReadSeeker, logWatcher *logger.LogWatcher, start, end int64, since time.Time) {
+	size, err := f.Seek(0, os.SEEK_END)
+	if err != nil {
+		logWatcher.Err <- err
+		return
+	}
+	if end == 0 || end > size {
+		end = size
+	}
+	if start >= size && size > 0 {
+		logWatcher.Err <- fmt.Errorf("byte range starts at %d, past the end of the logs at %d", start, size)
+		return
+	}
+
+	// if start is not at the beginning of a line, skip to the next one
+	atLineStart := start == 0
+	if !atLineStart {
+		if _, err := f.Seek(start-1, os.SEEK_SET); err != nil {
+			logWatcher.Err <- err
+			return
+		}
+		var prev [1]byte
+		if _, err := io.ReadFull(f, prev[:]); err != nil {
+			logWatcher.Err <- err
+			return
+		}
+		atLineStart = prev[0] == '\n'
+	}
+	if _, err := f.Seek(start, os.SEEK_SET); err != nil {
+		logWatcher.Err <- err
+		return
+	}
+
+	rdr := bufio.NewReader(io.LimitReader(f, end-start))
+	if !atLineStart {
+		if _, err := rdr.ReadBytes('\n'); err != nil {
+			// there isn't a complete line in the range
+			return
+		}
+	}
+
+	l := &jsonlog.JSONLog{}
+	for {
+		line, err := rdr.ReadBytes('\n')
+		if err != nil {
+			// either the end of the range, or a partial line cut off by it
+			return
+		}
+		l.Reset()
+		if err := json.Unmarshal(line, l); err != nil {
+			logWatcher.Err <- err
+			return
+		}
+		if !since.IsZero() && l.Created.Before(since) {
+			continue
+		}
+		msg := jsonLogToMessage(l)
+		select {
+		case <-logWatcher.WatchClose():
+			return
+		case logWatcher.Msg <- msg:
+		}
+	}
+}
+
+// readLineRange sends count messages from f, starting with the message at
+// index start. a count of 0 means the rest of f.
+func readLineRange(f io.Reader, logWatcher *logger.LogWatcher, start, count int64, since time.Time) {
+	rdr := bufio.NewReader(f)
+	for i := int64(0); i < start; i++ {
+		if _, err := rdr.ReadSlice('\n'); err != nil {
+			if err == bufio.ErrBufferFull {
+				// a line longer than the buffer, keep skipping it
+				i--
+				continue
+			}
+			if err != io.EOF {
+				logWatcher.Err <- err
+			}
+			return
+		}
+	}
+
+	dec := json.NewDecoder(rdr)
+	l := &jsonlog.JSONLog{}
+	for sent := int64(0); count == 0 || sent < count; sent++ {
+		msg, err := decodeLogLine(dec, l)
+		if err != nil {
+			if err != io.EOF {
+				logWatcher.Err <- err
+			}
+			return
+		}
+		if !since.IsZero() && msg.Timestamp.Before(since) {
+			continue
+		}
+		select {
+		case <-logWatcher.WatchClose():
+			return
+		case logWatcher.Msg <- msg:
+		}
+	}
+}
+
 func watchFile(name string) (filenotify.FileWatcher, error) {
 	fileWatcher, err := filenotify.New()
 	if err != nil {
@@ -203,6 +370,11 @@ func followLogs(f *os.File, logWatcher *logger.LogWatcher, notifyRotate chan int
 				break
 			}
 		}
+		if os.IsNotExist(err) {
+			// the file may only be missing for now, reading again later
+			// could work
+			return logger.TransientReadError{Err: err}
+		}
 		if err != nil {
 			return err
 		}
@@ -235,7 +407,7 @@ func followLogs(f *os.File, logWatcher *logger.LogWatcher, notifyRotate chan int
 			}
 			return errRetry
 		case err := <-fileWatcher.Errors():
-			logrus.Debug("logger got error watching file: %v", err)
+			logrus.Debugf("logger got error watching file: %v", err)
 			// Something happened, let's try and stay alive and create a new watcher
 			if retries <= 5 {
 				fileWatcher.Close()
@@ -0,0 +1,232 @@
+package jsonfilelog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/daemon/logger"
+)
+
+// newTestLogger returns a json-file logger in a temporary directory that has
+// logged the given lines, and the path of its log file
+func newTestLogger(t *testing.T, config map[string]string, lines ...string) (*JSONFileLogger, string, func()) {
+	tmp, err := ioutil.TempDir("", "docker-logger-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(tmp, "container.log")
+	l, err := New(logger.Info{
+		ContainerID: "a7317399f3f857173c6179d44823594f8294678dea9999662e5c625b5a1c7657",
+		LogPath:     filename,
+		Config:      config,
+	})
+	if err != nil {
+		os.RemoveAll(tmp)
+		t.Fatal(err)
+	}
+	ts := time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC)
+	for _, line := range lines {
+		if err := l.Log(&logger.Message{Line: []byte(line), Source: "stdout", Timestamp: ts}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return l.(*JSONFileLogger), filename, func() {
+		l.Close()
+		os.RemoveAll(tmp)
+	}
+}
+
+// readAll reads logs with the given config until the watcher is done
+func readAll(t *testing.T, l logger.LogReader, config logger.ReadConfig) ([]string, error) {
+	watcher := l.ReadLogs(config)
+	defer watcher.Close()
+
+	var lines []string
+	for {
+		select {
+		case msg, ok := <-watcher.Msg:
+			if !ok {
+				return lines, nil
+			}
+			lines = append(lines, string(msg.Line))
+		case err := <-watcher.Err:
+			return lines, err
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout reading logs")
+		}
+	}
+}
+
+func TestReadLogsByteRange(t *testing.T) {
+	l, _, cleanup := newTestLogger(t, nil, "one", "two", "three")
+	defer cleanup()
+
+	// {"log":"one\n","stream":"stdout","time":"2017-05-01T10:00:00Z"} and
+	// its newline are 64 bytes, and so is the line for "two"
+	const lineLen = 64
+	testCases := []struct {
+		start, end int64
+		expected   []string
+	}{
+		{0, 0, []string{"one\n", "two\n", "three\n"}},
+		{0, lineLen, []string{"one\n"}},
+		// the first and last lines are cut off by the range
+		{1, 2*lineLen + 1, []string{"two\n"}},
+		{lineLen, 0, []string{"two\n", "three\n"}},
+		{lineLen + 1, lineLen + 10, nil},
+	}
+	for _, tc := range testCases {
+		lines, err := readAll(t, l, logger.ReadConfig{ByteStart: tc.start, ByteEnd: tc.end, Tail: -1})
+		if err != nil {
+			t.Fatalf("range %d-%d: %v", tc.start, tc.end, err)
+		}
+		if len(lines) != len(tc.expected) {
+			t.Fatalf("range %d-%d: expected %q, got %q", tc.start, tc.end, tc.expected, lines)
+		}
+		for i := range lines {
+			if lines[i] != tc.expected[i] {
+				t.Fatalf("range %d-%d: expected %q, got %q", tc.start, tc.end, tc.expected, lines)
+			}
+		}
+	}
+
+	if _, err := readAll(t, l, logger.ReadConfig{ByteStart: 10 * lineLen}); err == nil {
+		t.Fatal("expected error for a range starting past the end of the logs")
+	}
+
+	if !logger.GetReaderCapabilities(l).ByteRange {
+		t.Fatal("expected json-file to support byte ranges")
+	}
+}
+
+func TestReadLogsTailBytes(t *testing.T) {
+	l, _, cleanup := newTestLogger(t, nil, "one", "two", "three")
+	defer cleanup()
+
+	// the lines for "one" and "two" are 64 bytes each, and "three" is 66
+	testCases := []struct {
+		budget   int64
+		tail     int
+		expected []string
+	}{
+		{66, -1, []string{"three\n"}},
+		// a budget that ends in the middle of a line skips that line
+		{100, -1, []string{"three\n"}},
+		{130, -1, []string{"two\n", "three\n"}},
+		{1024, -1, []string{"one\n", "two\n", "three\n"}},
+		{10, -1, nil},
+		// the tail is more restrictive than the budget
+		{1024, 1, []string{"three\n"}},
+		// the budget is more restrictive than the tail
+		{130, 3, []string{"two\n", "three\n"}},
+	}
+	for _, tc := range testCases {
+		lines, err := readAll(t, l, logger.ReadConfig{TailBytes: tc.budget, Tail: tc.tail})
+		if err != nil {
+			t.Fatalf("budget %d, tail %d: %v", tc.budget, tc.tail, err)
+		}
+		if len(lines) != len(tc.expected) {
+			t.Fatalf("budget %d, tail %d: expected %q, got %q", tc.budget, tc.tail, tc.expected, lines)
+		}
+		for i := range lines {
+			if lines[i] != tc.expected[i] {
+				t.Fatalf("budget %d, tail %d: expected %q, got %q", tc.budget, tc.tail, tc.expected, lines)
+			}
+		}
+	}
+}
+
+func TestReadLogsLineRange(t *testing.T) {
+	l, filename, cleanup := newTestLogger(t, map[string]string{"max-file": "2"}, "three", "four")
+	defer cleanup()
+
+	var rotated []byte
+	for _, line := range []string{"one", "two"} {
+		rotated = append(rotated, `{"log":"`+line+`\n","stream":"stdout","time":"2017-05-01T10:00:00Z"}`+"\n"...)
+	}
+	if err := ioutil.WriteFile(filename+".1", rotated, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		start, count int64
+		expected     []string
+	}{
+		{0, 1, []string{"one\n"}},
+		// across the rotated and current files
+		{1, 2, []string{"two\n", "three\n"}},
+		{2, 0, []string{"three\n", "four\n"}},
+		{3, 10, []string{"four\n"}},
+		{10, 0, nil},
+	}
+	for _, tc := range testCases {
+		// following is ignored for a line range
+		lines, err := readAll(t, l, logger.ReadConfig{LineStart: tc.start, LineCount: tc.count, Follow: true})
+		if err != nil {
+			t.Fatalf("lines %d+%d: %v", tc.start, tc.count, err)
+		}
+		if len(lines) != len(tc.expected) {
+			t.Fatalf("lines %d+%d: expected %q, got %q", tc.start, tc.count, tc.expected, lines)
+		}
+		for i := range lines {
+			if lines[i] != tc.expected[i] {
+				t.Fatalf("lines %d+%d: expected %q, got %q", tc.start, tc.count, tc.expected, lines)
+			}
+		}
+	}
+}
+
+func TestFollowLogsRotateOpenError(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		replace   func(name string) error
+		transient bool
+	}{
+		// the new file isn't there yet, which may not last
+		{"missing", func(string) error { return nil }, true},
+		// the new file can never be opened
+		{"unopenable", func(name string) error { return os.Symlink(name, name) }, false},
+	} {
+		tmp, err := ioutil.TempDir("", "docker-logger-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(tmp)
+		name := filepath.Join(tmp, "container.log")
+		f, err := os.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		watcher := logger.NewLogWatcher()
+		notifyRotate := make(chan interface{}, 1)
+		done := make(chan struct{})
+		go func() {
+			followLogs(f, watcher, notifyRotate, time.Time{})
+			close(done)
+		}()
+		// give the follower time to start watching the file
+		time.Sleep(100 * time.Millisecond)
+
+		if err := os.Rename(name, name+".1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tc.replace(name); err != nil {
+			t.Fatal(err)
+		}
+		notifyRotate <- struct{}{}
+
+		select {
+		case err := <-watcher.Err:
+			if logger.IsTransientReadError(err) != tc.transient {
+				t.Fatalf("%s: expected transient %v, got %T: %v", tc.name, tc.transient, err, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: timeout waiting for the error", tc.name)
+		}
+		<-done
+	}
+}
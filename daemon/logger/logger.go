@@ -19,6 +19,23 @@ import (
 // ErrReadLogsNotSupported is returned when the logger does not support reading logs.
 var ErrReadLogsNotSupported = errors.New("configured logging driver does not support reading")
 
+// TransientReadError is sent by a LogReader for an error that may not happen
+// again if the logs are read again, like a log file that is briefly missing
+// during rotation.
+type TransientReadError struct {
+	Err error
+}
+
+func (e TransientReadError) Error() string {
+	return e.Err.Error()
+}
+
+// IsTransientReadError returns true if the error is a TransientReadError
+func IsTransientReadError(err error) bool {
+	_, ok := err.(TransientReadError)
+	return ok
+}
+
 const (
 	// TimeFormat is the time format used for timestamps sent to log readers.
 	TimeFormat           = jsonlog.RFC3339NanoFixed
@@ -39,6 +56,24 @@ func PutMessage(msg *Message) {
 	messagePool.Put(msg)
 }
 
+// readMessagePool is kept apart from messagePool so that a consumer holding
+// on to a message it read can't corrupt messages still in use by a copier.
+var readMessagePool = &sync.Pool{New: func() interface{} { return &Message{Line: make([]byte, 0, 256)} }}
+
+// NewReadMessage returns a new message from the pool of messages sent to log
+// readers.
+func NewReadMessage() *Message {
+	return readMessagePool.Get().(*Message)
+}
+
+// PutReadMessage puts a message obtained from NewReadMessage back in the pool
+// of messages sent to log readers.
+// The message fields are reset before putting into the pool.
+func PutReadMessage(msg *Message) {
+	msg.reset()
+	readMessagePool.Put(msg)
+}
+
 // Message is datastructure that represents piece of output produced by some
 // container.  The Line member is a slice of an array whose contents can be
 // changed after a log driver's Log() method returns.
@@ -85,6 +120,26 @@ type ReadConfig struct {
 	Since  time.Time
 	Tail   int
 	Follow bool
+
+	// ByteStart and ByteEnd limit reading to the messages that lie entirely
+	// within this range of bytes of the log files, oldest file first. A
+	// ByteEnd of 0 means the end of the logs. They are only honored by
+	// readers with the ByteRange capability.
+	ByteStart int64
+	ByteEnd   int64
+
+	// TailBytes, if greater than zero, limits reading the existing logs to
+	// the complete messages in the last TailBytes bytes of the log files.
+	// If Tail is also set, whichever gives fewer messages wins. It is only
+	// honored by readers with the TailBytes capability.
+	TailBytes int64
+
+	// LineStart and LineCount limit reading to LineCount messages, starting
+	// with the message at index LineStart of the existing logs, oldest
+	// first. A LineCount of 0 reads to the end of the logs. They are only
+	// honored by readers with the LineRange capability.
+	LineStart int64
+	LineCount int64
 }
 
 // LogReader is the interface for reading log messages for loggers that support reading.
@@ -93,6 +148,38 @@ type LogReader interface {
 	ReadLogs(ReadConfig) *LogWatcher
 }
 
+// ReaderCapabilities describes which optional parts of a ReadConfig a
+// LogReader honors.
+type ReaderCapabilities struct {
+	// ByteRange is true if ByteStart and ByteEnd are honored
+	ByteRange bool
+	// TailBytes is true if TailBytes is honored
+	TailBytes bool
+	// LineRange is true if LineStart and LineCount are honored
+	LineRange bool
+	// ReadUnsupported is true if ReadLogs is only there to satisfy the
+	// interface, and doesn't read anything. It lets callers tell a reader
+	// that has no logs yet from one that will never have any.
+	ReadUnsupported bool
+}
+
+// CapableLogReader is a LogReader that reports which optional parts of a
+// ReadConfig it honors.
+type CapableLogReader interface {
+	LogReader
+	ReaderCapabilities() ReaderCapabilities
+}
+
+// GetReaderCapabilities returns the capabilities of a LogReader. A LogReader
+// that doesn't implement CapableLogReader honors none of the optional parts
+// of a ReadConfig.
+func GetReaderCapabilities(r LogReader) ReaderCapabilities {
+	if c, ok := r.(CapableLogReader); ok {
+		return c.ReaderCapabilities()
+	}
+	return ReaderCapabilities{}
+}
+
 // LogWatcher is used when consuming logs read from the LogReader interface.
 type LogWatcher struct {
 	// For sending log messages to a reader.
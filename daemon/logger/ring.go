@@ -34,6 +34,10 @@ func (r *ringWithReader) ReadLogs(cfg ReadConfig) *LogWatcher {
 	return reader.ReadLogs(cfg)
 }
 
+func (r *ringWithReader) ReaderCapabilities() ReaderCapabilities {
+	return GetReaderCapabilities(r.l.(LogReader))
+}
+
 func newRingLogger(driver Logger, logInfo Info, maxSize int64) *RingLogger {
 	l := &RingLogger{
 		buffer:  newRing(maxSize),
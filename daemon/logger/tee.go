@@ -0,0 +1,94 @@
+package logger
+
+import "github.com/docker/docker/api/types/backend"
+
+// TeeLogger is a Logger that sends every message to a primary logger and any
+// number of secondary loggers. Reading logs back, if supported at all, is only
+// done from the primary logger.
+type TeeLogger struct {
+	primary     Logger
+	secondaries []Logger
+}
+
+type teeWithReader struct {
+	*TeeLogger
+}
+
+func (t *teeWithReader) ReadLogs(cfg ReadConfig) *LogWatcher {
+	reader, ok := t.primary.(LogReader)
+	if !ok {
+		// something is wrong if we get here
+		panic("expected log reader")
+	}
+	return reader.ReadLogs(cfg)
+}
+
+func (t *teeWithReader) ReaderCapabilities() ReaderCapabilities {
+	return GetReaderCapabilities(t.primary.(LogReader))
+}
+
+// NewTeeLogger creates a new Logger that duplicates each message to the
+// secondary loggers before passing it to the primary. If the primary logger
+// is a LogReader, so is the returned Logger.
+func NewTeeLogger(primary Logger, secondaries ...Logger) Logger {
+	t := &TeeLogger{
+		primary:     primary,
+		secondaries: secondaries,
+	}
+	if _, ok := primary.(LogReader); ok {
+		return &teeWithReader{t}
+	}
+	return t
+}
+
+// Log sends a copy of the message to each of the secondary loggers, and then
+// the message itself to the primary logger. Loggers take ownership of the
+// messages they are given, which is why each one gets its own copy. Every
+// logger is tried even if one fails; the first error encountered is returned.
+func (t *TeeLogger) Log(msg *Message) error {
+	var firstErr error
+	for _, l := range t.secondaries {
+		if err := l.Log(copyMessage(msg)); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err := t.primary.Log(msg); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// Name returns the name of the primary logger
+func (t *TeeLogger) Name() string {
+	return t.primary.Name()
+}
+
+// Close closes all of the loggers, returning the first error encountered
+func (t *TeeLogger) Close() error {
+	var firstErr error
+	for _, l := range t.secondaries {
+		if err := l.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if err := t.primary.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// copyMessage returns a message from the pool holding a copy of msg
+func copyMessage(msg *Message) *Message {
+	m := NewMessage()
+	m.Line = append(m.Line, msg.Line...)
+	m.Source = msg.Source
+	m.Timestamp = msg.Timestamp
+	m.Partial = msg.Partial
+	if msg.Attrs != nil {
+		m.Attrs = make(backend.LogAttributes, len(msg.Attrs))
+		for k, v := range msg.Attrs {
+			m.Attrs[k] = v
+		}
+	}
+	return m
+}
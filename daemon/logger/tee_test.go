@@ -0,0 +1,55 @@
+package logger
+
+import (
+	"testing"
+	"time"
+)
+
+type mockReaderLogger struct {
+	mockLogger
+}
+
+func (l *mockReaderLogger) ReadLogs(ReadConfig) *LogWatcher {
+	return NewLogWatcher()
+}
+
+func TestTeeLoggerCopiesMessages(t *testing.T) {
+	primary := &mockLogger{make(chan *Message, 1)}
+	secondary := &mockLogger{make(chan *Message, 1)}
+	tee := NewTeeLogger(primary, secondary)
+
+	msg := NewMessage()
+	msg.Line = append(msg.Line, "hello"...)
+	msg.Source = "stdout"
+	msg.Timestamp = time.Now()
+	if err := tee.Log(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	p := <-primary.c
+	s := <-secondary.c
+	if p != msg {
+		t.Fatal("expected the primary logger to get the original message")
+	}
+	if s == msg {
+		t.Fatal("expected the secondary logger to get a copy of the message")
+	}
+	if string(s.Line) != "hello" || s.Source != "stdout" || !s.Timestamp.Equal(msg.Timestamp) {
+		t.Fatalf("secondary message does not match original: %+v", s)
+	}
+
+	// the primary owns its message, changing it must not affect the copy
+	p.Line[0] = 'j'
+	if string(s.Line) != "hello" {
+		t.Fatalf("expected copy to be unaffected, got %q", s.Line)
+	}
+}
+
+func TestTeeLoggerReadsFromPrimary(t *testing.T) {
+	if _, ok := NewTeeLogger(&mockLogger{}, &mockReaderLogger{}).(LogReader); ok {
+		t.Fatal("tee should not be a log reader when only a secondary can read")
+	}
+	if _, ok := NewTeeLogger(&mockReaderLogger{}, &mockLogger{}).(LogReader); !ok {
+		t.Fatal("tee should be a log reader when the primary can read")
+	}
+}
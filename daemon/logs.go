@@ -1,14 +1,22 @@
 package daemon
 
 import (
+	"encoding/base64"
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/net/context"
 
 	"github.com/Sirupsen/logrus"
-	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/backend"
 	containertypes "github.com/docker/docker/api/types/container"
 	timetypes "github.com/docker/docker/api/types/time"
@@ -22,23 +30,34 @@ import (
 //
 // if it returns nil, the config channel will be active and return log
 // messages until it runs out or the context is canceled.
-func (daemon *Daemon) ContainerLogs(ctx context.Context, containerName string, config *types.ContainerLogsOptions) (<-chan *backend.LogMessage, error) {
+func (daemon *Daemon) ContainerLogs(ctx context.Context, containerName string, config *backend.ContainerLogsConfig) (_ <-chan *backend.LogMessage, retErr error) {
 	lg := logrus.WithFields(logrus.Fields{
 		"module":    "daemon",
 		"method":    "(*Daemon).ContainerLogs",
 		"container": containerName,
 	})
 
-	if !(config.ShowStdout || config.ShowStderr) {
-		return nil, errors.New("You must choose at least one stream")
+	if err := validateLogsConfig(config); err != nil {
+		return nil, err
 	}
-	container, err := daemon.GetContainer(containerName)
+	container, err := daemon.getLogsContainer(containerName)
 	if err != nil {
 		return nil, err
 	}
 
 	if container.RemovalInProgress || container.Dead {
-		return nil, errors.New("can not get logs from container which is dead or marked for removal")
+		if !config.ReadDeadContainer {
+			return nil, errors.New("can not get logs from container which is dead or marked for removal")
+		}
+		// starting a logger for a driver that writes to the container's
+		// directory would recreate the log file if removal already got to
+		// it, so make sure there is still something to read
+		if container.LogPath != "" {
+			if _, err := os.Stat(container.LogPath); err != nil {
+				return nil, fmt.Errorf("can not get logs from container which is dead or marked for removal: %v", err)
+			}
+		}
+		lg.Debug("reading logs of dead or removing container")
 	}
 
 	if container.HostConfig.LogConfig.Type == "none" {
@@ -50,94 +69,663 @@ func (daemon *Daemon) ContainerLogs(ctx context.Context, containerName string, c
 		return nil, err
 	}
 	if cLogCreated {
+		// once the stream is started, it closes the logger when it is done
+		// reading, so only close it here if this fails before that
 		defer func() {
-			if err = cLog.Close(); err != nil {
-				logrus.Errorf("Error closing logger: %v", err)
+			if retErr != nil {
+				closeCreatedLogger(lg, cLog)
 			}
 		}()
 	}
 
 	logReader, ok := cLog.(logger.LogReader)
-	if !ok {
+	if !ok || logger.GetReaderCapabilities(logReader).ReadUnsupported {
 		return nil, logger.ErrReadLogsNotSupported
 	}
 
 	follow := config.Follow && !cLogCreated
+	var notices []*backend.LogMessage
+	if config.Follow && !follow {
+		if config.StrictFollow {
+			return nil, fmt.Errorf("can not follow the logs of container %s, which is not running", containerName)
+		}
+		lg.Info("container is not running, reading logs without following")
+		if config.ReportNotices {
+			notices = append(notices, &backend.LogMessage{
+				Line:      []byte("container is not running, its logs will not be followed\n"),
+				Source:    backend.LogSourceNotice,
+				Timestamp: time.Now().UTC(),
+				Attrs:     backend.LogAttributes{"reason": "follow-not-running"},
+			})
+		}
+	}
 	tailLines, err := strconv.Atoi(config.Tail)
 	if err != nil {
 		tailLines = -1
 	}
 
-	var since time.Time
-	if config.Since != "" {
-		s, n, err := timetypes.ParseTimestamps(config.Since, 0)
-		if err != nil {
-			return nil, err
+	stream, err := newLogStream(config)
+	if err != nil {
+		return nil, err
+	}
+	stream.lg = lg
+	stream.notices = notices
+	if cLogCreated {
+		stream.closeLogger = func() { closeCreatedLogger(lg, cLog) }
+	}
+	if follow && config.ReportExit {
+		stream.exitMessage = func(ctx context.Context) *backend.LogMessage {
+			return exitMessage(ctx, container)
 		}
-		since = time.Unix(s, n)
 	}
 
-	readConfig := logger.ReadConfig{
-		Since:  since,
-		Tail:   tailLines,
-		Follow: follow,
+	if config.ByteStart != 0 || config.ByteEnd != 0 {
+		if !logger.GetReaderCapabilities(logReader).ByteRange {
+			return nil, fmt.Errorf("the %s log driver does not support reading byte ranges", cLog.Name())
+		}
+	}
+
+	if config.TailBytes > 0 && !logger.GetReaderCapabilities(logReader).TailBytes {
+		return nil, fmt.Errorf("the %s log driver does not support tailing by bytes", cLog.Name())
 	}
 
-	logs := logReader.ReadLogs(readConfig)
+	if (config.LineStart != 0 || config.LineCount != 0) && !logger.GetReaderCapabilities(logReader).LineRange {
+		return nil, fmt.Errorf("the %s log driver does not support reading line ranges", cLog.Name())
+	}
+
+	readConfig := logger.ReadConfig{
+		Since:     stream.readSince(),
+		Tail:      tailLines,
+		Follow:    follow,
+		ByteStart: config.ByteStart,
+		ByteEnd:   config.ByteEnd,
+		TailBytes: config.TailBytes,
+		LineStart: config.LineStart,
+		LineCount: config.LineCount,
+	}
 
 	// past this point, we can't possibly return any errors, so we can just
 	// start a goroutine and return to tell the caller not to expect errors
 	// (if the caller wants to give up on logs, they have to cancel the context)
 	// this goroutine functions as a shim between the logger and the caller.
-	messageChan := make(chan *backend.LogMessage, 1)
-	go func() {
-		// set up some defers
-		defer logs.Close()
-
-		// close the messages channel. closing is the only way to signal above
-		// that we're doing with logs (other than context cancel i guess).
-		defer close(messageChan)
-
-		lg.Debug("begin logs")
-		for {
-			select {
-			// i do not believe as the system is currently designed any error
-			// is possible, but we should be prepared to handle it anyway. if
-			// we do get an error, copy only the error field to a new object so
-			// we don't end up with partial data in the other fields
-			case err := <-logs.Err:
-				lg.Errorf("Error streaming logs: %v", err)
-				select {
-				case <-ctx.Done():
-				case messageChan <- &backend.LogMessage{Err: err}:
-				}
-				return
-			case <-ctx.Done():
-				lg.Debug("logs: end stream, ctx is done: %v", ctx.Err())
-				return
-			case msg, ok := <-logs.Msg:
-				// there is some kind of pool or ring buffer in the logger that
-				// produces these messages, and a possible future optimization
-				// might be to use that pool and reuse message objects
-				if !ok {
-					lg.Debug("end logs")
-					return
-				}
-				m := msg.AsLogMessage() // just a pointer conversion, does not copy data
-
-				// there could be a case where the reader stops accepting
-				// messages and the context is canceled. we need to check that
-				// here, or otherwise we risk blocking forever on the message
-				// send.
-				select {
-				case <-ctx.Done():
-					return
-				case messageChan <- m:
-				}
+	bufferSize := 1
+	if config.MessageBuffer > 0 {
+		bufferSize = config.MessageBuffer
+	}
+	messageChan := make(chan *backend.LogMessage, bufferSize)
+	go stream.run(ctx, logReader, readConfig, messageChan)
+	return messageChan, nil
+}
+
+// maxLogSnapshotMessages bounds the number of messages ContainerLogsSnapshot
+// returns
+const maxLogSnapshotMessages = 10000
+
+// ContainerLogsSnapshot reads the container's logs as ContainerLogs does, but
+// collects the messages and returns them all at once, for callers that only
+// want the logs as they are now. Following is not allowed. At most
+// maxLogSnapshotMessages messages are returned; use Tail to get the latest
+// ones from a long log.
+//
+// If reading fails part way, the messages read so far are returned along
+// with the error.
+func (daemon *Daemon) ContainerLogsSnapshot(ctx context.Context, containerName string, config *backend.ContainerLogsConfig) ([]*backend.LogMessage, error) {
+	if config.Follow {
+		return nil, errors.New("can not follow the logs of a snapshot")
+	}
+	// the messages are kept, so they can't be reused
+	snapshotConfig := *config
+	snapshotConfig.ReuseMessages = false
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	msgs, err := daemon.ContainerLogs(ctx, containerName, &snapshotConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot []*backend.LogMessage
+	for {
+		select {
+		case <-ctx.Done():
+			return snapshot, ctx.Err()
+		case m, ok := <-msgs:
+			if !ok {
+				return snapshot, nil
+			}
+			if m.Err != nil {
+				return snapshot, m.Err
+			}
+			snapshot = append(snapshot, m)
+			if len(snapshot) == maxLogSnapshotMessages {
+				return snapshot, nil
 			}
 		}
-	}()
-	return messageChan, nil
+	}
+}
+
+// messageRecycler puts the messages read from a logger back into the read
+// message pool once the consumer of a log stream is done with them. the consumer is
+// done with a message when it receives the next one, so with a channel buffer
+// of n messages, the last n+1 messages sent may still be in use.
+//
+// the methods of a nil recycler do nothing, so that it can be used whether or
+// not messages are reused.
+type messageRecycler struct {
+	// inUse is a ring of the messages that may still be in use, oldest at
+	// next
+	inUse []*logger.Message
+	next  int
+}
+
+func newMessageRecycler(buffer int) *messageRecycler {
+	return &messageRecycler{inUse: make([]*logger.Message, buffer+1)}
+}
+
+// sent records that msg was sent on the stream, and puts back the oldest
+// message sent, which the consumer can no longer be using
+func (r *messageRecycler) sent(msg *logger.Message) {
+	if r == nil {
+		return
+	}
+	if old := r.inUse[r.next]; old != nil {
+		logger.PutReadMessage(old)
+	}
+	r.inUse[r.next] = msg
+	r.next = (r.next + 1) % len(r.inUse)
+}
+
+// drop puts back a message that was never sent
+func (r *messageRecycler) drop(msg *logger.Message) {
+	if r == nil {
+		return
+	}
+	logger.PutReadMessage(msg)
+}
+
+// clampTimestamp moves the message forward to the given time, keeping its
+// original timestamp in its attributes
+func clampTimestamp(m *backend.LogMessage, t time.Time) {
+	// the attributes may be shared with other messages by the reader, so
+	// they're copied rather than changed
+	attrs := make(backend.LogAttributes, len(m.Attrs)+1)
+	for k, v := range m.Attrs {
+		attrs[k] = v
+	}
+	attrs["originalTimestamp"] = m.Timestamp.UTC().Format(time.RFC3339Nano)
+	m.Attrs = attrs
+	m.Timestamp = t
+}
+
+// logCursor is a position in a container's logs: the time of the last message
+// read, and how many messages with exactly that time were read. the count is
+// needed because messages can share a timestamp.
+type logCursor struct {
+	timestamp time.Time
+	count     int
+}
+
+// parseLogCursor parses a cursor returned by logCursor.String
+func parseLogCursor(cursor string) (logCursor, error) {
+	invalid := fmt.Errorf("invalid log cursor %q", cursor)
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return logCursor{}, invalid
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 2 {
+		return logCursor{}, invalid
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return logCursor{}, invalid
+	}
+	count, err := strconv.Atoi(parts[1])
+	if err != nil || count < 0 {
+		return logCursor{}, invalid
+	}
+	return logCursor{timestamp: time.Unix(0, nanos), count: count}, nil
+}
+
+// String encodes the cursor. the encoding is opaque to callers
+func (c logCursor) String() string {
+	var nanos int64
+	if !c.timestamp.IsZero() {
+		nanos = c.timestamp.UnixNano()
+	}
+	raw := fmt.Sprintf("%d:%d", nanos, c.count)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// advance moves the cursor past a message with the given timestamp
+func (c *logCursor) advance(timestamp time.Time) {
+	if timestamp.Equal(c.timestamp) {
+		c.count++
+		return
+	}
+	c.timestamp = timestamp
+	c.count = 1
+}
+
+// message returns a message reporting the cursor
+func (c logCursor) message() *backend.LogMessage {
+	return &backend.LogMessage{
+		Source:    backend.LogSourceCursor,
+		Timestamp: c.timestamp,
+		Attrs:     backend.LogAttributes{"cursor": c.String()},
+	}
+}
+
+// parseSourceSince parses the since of each source. it returns nil if there
+// are none
+func parseSourceSince(values map[string]string, layouts []string) (map[string]time.Time, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	sourceSince := make(map[string]time.Time, len(values))
+	for source, value := range values {
+		t, err := parseLogTime(value, layouts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid since for log source %s: %v", source, err)
+		}
+		sourceSince[source] = t
+	}
+	return sourceSince, nil
+}
+
+// beforeSourceSince returns true if the message is from before the since of
+// its source, or if its source doesn't have one, before since
+func beforeSourceSince(m *backend.LogMessage, since time.Time, sourceSince map[string]time.Time) bool {
+	if t, ok := sourceSince[m.Source]; ok {
+		since = t
+	}
+	return m.Timestamp.Before(since)
+}
+
+// parseLogTime parses a timestamp with each of the layouts in turn, falling
+// back to the unix timestamps that Since takes by default
+func parseLogTime(value string, layouts []string) (time.Time, error) {
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	s, n, err := timetypes.ParseTimestamps(value, 0)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(s, n), nil
+}
+
+// logWindow is a parsed types.LogTimeWindow. a zero until means the window
+// has no end.
+type logWindow struct {
+	since, until time.Time
+}
+
+// logWindows is a list of windows sorted by their start
+type logWindows []logWindow
+
+// parseLogWindows parses the windows and sorts them by their start
+func parseLogWindows(windows []backend.LogTimeWindow, layouts []string) (logWindows, error) {
+	parsed := make(logWindows, 0, len(windows))
+	for _, w := range windows {
+		if w.Since == "" {
+			return nil, errors.New("a log time window must have a start")
+		}
+		since, err := parseLogTime(w.Since, layouts)
+		if err != nil {
+			return nil, err
+		}
+		window := logWindow{since: since}
+		if w.Until != "" {
+			window.until, err = parseLogTime(w.Until, layouts)
+			if err != nil {
+				return nil, err
+			}
+			if !window.until.After(window.since) {
+				return nil, fmt.Errorf("log time window %s to %s must end after it starts", w.Since, w.Until)
+			}
+		}
+		parsed = append(parsed, window)
+	}
+	sort.Sort(parsed)
+	return parsed, nil
+}
+
+func (ws logWindows) Len() int           { return len(ws) }
+func (ws logWindows) Less(i, j int) bool { return ws[i].since.Before(ws[j].since) }
+func (ws logWindows) Swap(i, j int)      { ws[i], ws[j] = ws[j], ws[i] }
+
+// contain returns true if the timestamp is within any of the windows. both
+// ends of a window are inclusive.
+func (ws logWindows) contain(t time.Time) bool {
+	for _, w := range ws {
+		if !t.Before(w.since) && (w.until.IsZero() || !t.After(w.until)) {
+			return true
+		}
+	}
+	return false
+}
+
+// getLogsContainer looks up a container for reading logs. in addition to the
+// usual ways of referring to a container, "name^N" refers to the container
+// that held the name N renames ago, as long as it still exists. removing a
+// container removes its logs, so removals aren't recorded.
+func (daemon *Daemon) getLogsContainer(name string) (*container.Container, error) {
+	i := strings.LastIndex(name, "^")
+	if i < 0 {
+		return daemon.GetContainer(name)
+	}
+	n, err := strconv.Atoi(name[i+1:])
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid previous container selector %q: expected name^N, with N at least 1", name)
+	}
+
+	base := name[:i]
+	if !strings.HasPrefix(base, "/") {
+		base = "/" + base
+	}
+	previous := daemon.nameHistory.get(base)
+	if n > len(previous) {
+		if len(previous) == 0 {
+			return nil, fmt.Errorf("no previous containers are known for the name %s", base)
+		}
+		return nil, fmt.Errorf("only %d previous containers are known for the name %s: %s", len(previous), base, strings.Join(previous, ", "))
+	}
+
+	c, err := daemon.GetContainer(previous[n-1])
+	if err != nil {
+		return nil, fmt.Errorf("container %s, which was renamed from %s, has been removed along with its logs. previous containers for the name: %s", previous[n-1], base, strings.Join(previous, ", "))
+	}
+	return c, nil
+}
+
+// exitMessage waits for the container to stop running, and returns a message
+// describing how it exited. it returns nil if the context is done first.
+func exitMessage(ctx context.Context, c *container.Container) *backend.LogMessage {
+	status := <-c.Wait(ctx, container.WaitConditionNotRunning)
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	c.Lock()
+	finishedAt := c.FinishedAt
+	c.Unlock()
+
+	exitCode := status.ExitCode()
+	attrs := backend.LogAttributes{"exitCode": strconv.Itoa(exitCode)}
+	line := fmt.Sprintf("container exited with code %d", exitCode)
+	// like a shell, we take an exit code above 128 to mean the process was
+	// killed by signal (code - 128). we don't have any better information.
+	if exitCode > 128 && runtime.GOOS != "windows" {
+		attrs["signal"] = strconv.Itoa(exitCode - 128)
+		line = fmt.Sprintf("%s (signal %d)", line, exitCode-128)
+	}
+	return &backend.LogMessage{
+		Line:      []byte(line + "\n"),
+		Source:    backend.LogSourceExit,
+		Timestamp: finishedAt,
+		Attrs:     attrs,
+	}
+}
+
+// defaultLogErrorPattern matches the lines of stdout shown by ErrorsOnly if
+// no other pattern is given
+const defaultLogErrorPattern = `(?i)\b(error|fatal|panic|exception|fail|failed|failure)\b`
+
+// compileLogErrorPattern compiles the pattern for ErrorsOnly, which must
+// already have been validated
+func compileLogErrorPattern(pattern string) *regexp.Regexp {
+	if pattern == "" {
+		pattern = defaultLogErrorPattern
+	}
+	return regexp.MustCompile(pattern)
+}
+
+// validateLogsConfig checks that the options in the config make sense
+// together, so that requests that can't be satisfied fail before any logs
+// are streamed. It turns on the streams ErrorsOnly implies first.
+func validateLogsConfig(config *backend.ContainerLogsConfig) error {
+	if config.ErrorsOnly {
+		config.ShowStdout = true
+		config.ShowStderr = true
+	}
+	if !(config.ShowStdout || config.ShowStderr) {
+		return errors.New("You must choose at least one stream")
+	}
+	if config.DetailsJSON && !config.Details {
+		return errors.New("JSON details can only be used when details are requested")
+	}
+	if config.IncludeSource && !config.Details {
+		return errors.New("the source can only be included when details are requested")
+	}
+	if len(config.DetailKeys) > 0 && len(config.DetailExcludeKeys) > 0 {
+		return errors.New("detail keys and excluded detail keys can not be used together")
+	}
+	if config.TailBuffer < 0 {
+		return errors.New("tail buffer size can not be negative")
+	}
+	if config.TailBuffer > 0 && config.Follow {
+		return errors.New("tail buffer can not be used when following logs")
+	}
+	if config.DedupWindow < 0 {
+		return errors.New("dedup window size can not be negative")
+	}
+	if config.RotateSize < 0 || config.RotateInterval < 0 {
+		return errors.New("log rotation size and interval can not be negative")
+	}
+	if config.MessageBuffer < 0 {
+		return errors.New("message buffer size can not be negative")
+	}
+	if config.Cursor != "" {
+		if config.Since != "" || (config.Tail != "" && config.Tail != "all") {
+			return errors.New("a log cursor can not be used together with since or tail")
+		}
+		if _, err := parseLogCursor(config.Cursor); err != nil {
+			return err
+		}
+	}
+	if config.ByteStart < 0 || config.ByteEnd < 0 {
+		return errors.New("byte range offsets can not be negative")
+	}
+	if config.ByteEnd != 0 && config.ByteEnd <= config.ByteStart {
+		return errors.New("byte range must end after it starts")
+	}
+	if config.ByteStart != 0 || config.ByteEnd != 0 {
+		if config.Follow {
+			return errors.New("a byte range can not be used when following logs")
+		}
+		if config.Tail != "" && config.Tail != "all" {
+			return errors.New("a byte range can not be used together with tail")
+		}
+	}
+	if config.ReadRetries < 0 {
+		return errors.New("read retries can not be negative")
+	}
+	if config.ReadRetries > 0 && (config.ByteStart != 0 || config.ByteEnd != 0 || config.LineStart != 0 || config.LineCount != 0 || config.TailBytes != 0) {
+		return errors.New("read retries can not be used together with byte or line ranges, or tail bytes")
+	}
+	if config.TailBytes < 0 {
+		return errors.New("tail bytes can not be negative")
+	}
+	if config.TailBytes > 0 && (config.ByteStart != 0 || config.ByteEnd != 0 || config.Cursor != "") {
+		return errors.New("tail bytes can not be used together with a byte range or a cursor")
+	}
+	if config.Since != "" {
+		if _, err := parseLogTime(config.Since, config.TimeLayouts); err != nil {
+			return err
+		}
+	}
+	if config.LineStart < 0 || config.LineCount < 0 {
+		return errors.New("line range start and count can not be negative")
+	}
+	if config.LineStart != 0 || config.LineCount != 0 {
+		switch {
+		case config.Follow:
+			return errors.New("a line range can not be used when following logs")
+		case config.Tail != "" && config.Tail != "all", config.TailBytes != 0:
+			return errors.New("a line range can not be used together with tail")
+		case config.ByteStart != 0 || config.ByteEnd != 0:
+			return errors.New("a line range can not be used together with a byte range")
+		case config.Cursor != "":
+			return errors.New("a line range can not be used together with a cursor")
+		}
+	}
+	if len(config.Windows) > 0 {
+		if config.Since != "" || config.Cursor != "" {
+			return errors.New("log time windows can not be used together with since or a cursor")
+		}
+		if _, err := parseLogWindows(config.Windows, config.TimeLayouts); err != nil {
+			return err
+		}
+	}
+	if len(config.SourceSince) > 0 {
+		if config.Cursor != "" || len(config.Windows) > 0 {
+			return errors.New("per source since can not be used together with a cursor or time windows")
+		}
+		if _, err := parseSourceSince(config.SourceSince, config.TimeLayouts); err != nil {
+			return err
+		}
+	}
+	switch config.LineEndings {
+	case "", "lf", "crlf":
+	default:
+		return fmt.Errorf("invalid line ending style %s: must be lf or crlf", config.LineEndings)
+	}
+	for source, stream := range config.SourceStreams {
+		if stream != "" && stream != "stdout" && stream != "stderr" {
+			return fmt.Errorf("log source %s must be mapped to stdout, stderr or nothing, not %s", source, stream)
+		}
+	}
+	if config.ErrorPattern != "" {
+		if !config.ErrorsOnly {
+			return errors.New("an error pattern can only be used when showing errors only")
+		}
+		if _, err := regexp.Compile(config.ErrorPattern); err != nil {
+			return fmt.Errorf("invalid error pattern: %v", err)
+		}
+	}
+	if config.StopOnMatch != "" {
+		if _, err := regexp.Compile(config.StopOnMatch); err != nil {
+			return fmt.Errorf("invalid stop pattern: %v", err)
+		}
+	}
+	if config.StripEmbeddedTimestamp != "" {
+		if _, err := regexp.Compile(config.StripEmbeddedTimestamp); err != nil {
+			return fmt.Errorf("invalid embedded timestamp pattern: %v", err)
+		}
+	}
+	return nil
+}
+
+// ContainerLogsCapabilities returns which log reading features are available
+// for the container, without reading any logs.
+func (daemon *Daemon) ContainerLogsCapabilities(containerName string) (*backend.LogCapabilities, error) {
+	lg := logrus.WithFields(logrus.Fields{
+		"module":    "daemon",
+		"method":    "(*Daemon).ContainerLogsCapabilities",
+		"container": containerName,
+	})
+
+	container, err := daemon.getLogsContainer(containerName)
+	if err != nil {
+		return nil, err
+	}
+
+	caps := &backend.LogCapabilities{}
+	if container.RemovalInProgress || container.Dead || container.HostConfig.LogConfig.Type == "none" {
+		return caps, nil
+	}
+
+	cLog, cLogCreated, err := daemon.getLogger(container)
+	if err != nil {
+		return nil, err
+	}
+	if cLogCreated {
+		defer closeCreatedLogger(lg, cLog)
+	}
+
+	logReader, ok := cLog.(logger.LogReader)
+	if !ok || logger.GetReaderCapabilities(logReader).ReadUnsupported {
+		return caps, nil
+	}
+	caps.ReadLogs = true
+	caps.Tail = true
+	caps.Since = true
+	// as in ContainerLogs, we can only follow the logger of a running
+	// container, not one we had to create to read the logs
+	caps.Follow = !cLogCreated
+	return caps, nil
+}
+
+// closeCreatedLogger closes a logger that was only started to read the logs
+// of a container that isn't running
+func closeCreatedLogger(lg *logrus.Entry, l logger.Logger) {
+	if err := l.Close(); err != nil {
+		lg.WithError(err).WithField("driver", l.Name()).Error("Error closing logger")
+	}
+}
+
+// maxLogDedupWindow bounds the number of message hashes a logDeduper keeps
+const maxLogDedupWindow = 4096
+
+// logDeduper remembers the hashes of the last few messages it has seen, so
+// that messages redelivered by a log driver can be dropped
+type logDeduper struct {
+	// window is a ring of the most recent hashes, oldest at next
+	window []uint64
+	next   int
+	full   bool
+	// seen is the set of hashes in the window
+	seen map[uint64]struct{}
+}
+
+func newLogDeduper(size int) *logDeduper {
+	if size > maxLogDedupWindow {
+		size = maxLogDedupWindow
+	}
+	return &logDeduper{
+		window: make([]uint64, size),
+		seen:   make(map[uint64]struct{}, size),
+	}
+}
+
+// seenRecently returns true if a message with the same timestamp, source and
+// line is in the window. otherwise, it adds the message to the window,
+// pushing out the oldest message if the window is full.
+func (d *logDeduper) seenRecently(m *backend.LogMessage) bool {
+	h := fnv.New64a()
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(m.Timestamp.UnixNano()))
+	h.Write(ts[:])
+	h.Write([]byte(m.Source))
+	h.Write([]byte{0})
+	h.Write(m.Line)
+	sum := h.Sum64()
+
+	if _, ok := d.seen[sum]; ok {
+		return true
+	}
+
+	if d.full {
+		delete(d.seen, d.window[d.next])
+	}
+	d.window[d.next] = sum
+	d.seen[sum] = struct{}{}
+	d.next++
+	if d.next == len(d.window) {
+		d.next = 0
+		d.full = true
+	}
+	return false
+}
+
+// ReadableLogDrivers returns the names of the built in log drivers that
+// support reading logs back, as needed by ContainerLogs. Log driver plugins
+// are not included.
+func (daemon *Daemon) ReadableLogDrivers() []string {
+	return logger.ListReadableDrivers()
 }
 
 func (daemon *Daemon) getLogger(container *container.Container) (l logger.Logger, created bool, err error) {
@@ -148,13 +736,26 @@ func (daemon *Daemon) getLogger(container *container.Container) (l logger.Logger
 	container.Unlock()
 	if l == nil {
 		created = true
-		l, err = container.StartLogger()
+		// secondary drivers are only written to, so there is no need to
+		// start them, or to fail if they can't be started, just to read
+		l, err = container.StartPrimaryLogger()
 	}
 	return
 }
 
 // mergeLogConfig merges the daemon log config to the container's log config if the container's log driver is not specified.
 func (daemon *Daemon) mergeAndVerifyLogConfig(cfg *containertypes.LogConfig) error {
+	daemon.mergeLogConfig(cfg)
+
+	if err := logger.ValidateLogOpts(cfg.Type, cfg.Config); err != nil {
+		return err
+	}
+	return verifySecondaryLogConfigs(cfg)
+}
+
+// mergeLogConfig fills in the daemon's default log driver, and its default
+// options if the driver is the default one.
+func (daemon *Daemon) mergeLogConfig(cfg *containertypes.LogConfig) {
 	if cfg.Type == "" {
 		cfg.Type = daemon.defaultLogConfig.Type
 	}
@@ -170,6 +771,74 @@ func (daemon *Daemon) mergeAndVerifyLogConfig(cfg *containertypes.LogConfig) err
 			}
 		}
 	}
+}
+
+// ContainerLogConfig returns the log config that is in effect for the
+// container, with the daemon's defaults merged in. The container's own
+// config is not modified.
+func (daemon *Daemon) ContainerLogConfig(containerName string) (containertypes.LogConfig, error) {
+	container, err := daemon.GetContainer(containerName)
+	if err != nil {
+		return containertypes.LogConfig{}, err
+	}
+
+	container.Lock()
+	cfg := copyLogConfig(container.HostConfig.LogConfig)
+	container.Unlock()
+
+	daemon.mergeLogConfig(&cfg)
+	return cfg, nil
+}
+
+// copyLogConfig returns a deep copy of the log config
+func copyLogConfig(cfg containertypes.LogConfig) containertypes.LogConfig {
+	copied := containertypes.LogConfig{Type: cfg.Type}
+	if cfg.Config != nil {
+		copied.Config = make(map[string]string, len(cfg.Config))
+		for k, v := range cfg.Config {
+			copied.Config[k] = v
+		}
+	}
+	for _, secondary := range cfg.Secondary {
+		copied.Secondary = append(copied.Secondary, copyLogConfig(secondary))
+	}
+	return copied
+}
 
-	return logger.ValidateLogOpts(cfg.Type, cfg.Config)
+// verifySecondaryLogConfigs validates the secondary log drivers of a log
+// config. Secondary drivers do not get the daemon's default options merged in.
+func verifySecondaryLogConfigs(cfg *containertypes.LogConfig) error {
+	if len(cfg.Secondary) == 0 {
+		return nil
+	}
+	if cfg.Type == "none" {
+		return errors.New("secondary log drivers can not be used with the none log driver")
+	}
+
+	// each driver may only be used once, otherwise drivers that write to a
+	// path derived from the container (like json-file) would clobber each
+	// other
+	seen := map[string]bool{cfg.Type: true}
+	for i := range cfg.Secondary {
+		secondary := &cfg.Secondary[i]
+		switch {
+		case secondary.Type == "":
+			return errors.New("secondary log driver must have a type")
+		case secondary.Type == "none":
+			return errors.New("none can not be used as a secondary log driver")
+		case len(secondary.Secondary) > 0:
+			return fmt.Errorf("secondary log driver %s can not have secondary log drivers", secondary.Type)
+		case seen[secondary.Type]:
+			return fmt.Errorf("log driver %s is configured more than once", secondary.Type)
+		}
+		seen[secondary.Type] = true
+
+		if secondary.Config == nil {
+			secondary.Config = make(map[string]string)
+		}
+		if err := logger.ValidateLogOpts(secondary.Type, secondary.Config); err != nil {
+			return err
+		}
+	}
+	return nil
 }
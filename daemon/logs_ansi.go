@@ -0,0 +1,108 @@
+package daemon
+
+import "bytes"
+
+const ansiEscape = 0x1b
+
+// ansiStripper removes ANSI escape sequences from the messages of a single
+// stream. an escape sequence cut off at the end of a partial message is held
+// back, and completed with the start of the next message.
+type ansiStripper struct {
+	pending []byte
+}
+
+// strip returns the line without escape sequences. partial is true if the
+// line is continued by the next message of the stream.
+func (s *ansiStripper) strip(line []byte, partial bool) []byte {
+	if len(s.pending) > 0 {
+		line = append(s.pending, line...)
+		s.pending = nil
+	}
+	if bytes.IndexByte(line, ansiEscape) < 0 {
+		return line
+	}
+
+	stripped := make([]byte, 0, len(line))
+	for i := 0; i < len(line); {
+		if line[i] != ansiEscape {
+			stripped = append(stripped, line[i])
+			i++
+			continue
+		}
+		n := ansiSequenceLen(line[i:])
+		if n < 0 {
+			if partial {
+				s.pending = append([]byte(nil), line[i:]...)
+				return stripped
+			}
+			// the sequence will never be finished, so leave it be
+			return append(stripped, line[i:]...)
+		}
+		i += n
+	}
+	return stripped
+}
+
+// ansiSequenceLen returns the length of the escape sequence at the start of
+// b, which must start with an escape, or -1 if b ends before the sequence
+// does. invalid sequences are cut short at the first byte that doesn't
+// belong, so that text following them is kept.
+func ansiSequenceLen(b []byte) int {
+	if len(b) < 2 {
+		return -1
+	}
+	switch c := b[1]; {
+	case c == '[':
+		// control sequence: parameter bytes, intermediate bytes, then a
+		// final byte
+		j := 2
+		for j < len(b) && b[j] >= 0x30 && b[j] <= 0x3f {
+			j++
+		}
+		for j < len(b) && b[j] >= 0x20 && b[j] <= 0x2f {
+			j++
+		}
+		if j == len(b) {
+			return -1
+		}
+		if b[j] >= 0x40 && b[j] <= 0x7e {
+			return j + 1
+		}
+		return j
+	case c == ']' || c == 'P' || c == 'X' || c == '^' || c == '_':
+		// operating system command and other strings, ended by BEL or by
+		// the string terminator ESC \
+		for j := 2; j < len(b); j++ {
+			if b[j] == 0x07 {
+				return j + 1
+			}
+			if b[j] == ansiEscape {
+				if j+1 == len(b) {
+					return -1
+				}
+				if b[j+1] == '\\' {
+					return j + 2
+				}
+			}
+		}
+		return -1
+	case c >= 0x20 && c <= 0x2f:
+		// intermediate bytes, then a final byte, like ESC ( B
+		j := 1
+		for j < len(b) && b[j] >= 0x20 && b[j] <= 0x2f {
+			j++
+		}
+		if j == len(b) {
+			return -1
+		}
+		if b[j] >= 0x30 && b[j] <= 0x7e {
+			return j + 1
+		}
+		return j
+	case c >= 0x30 && c <= 0x7e:
+		return 2
+	default:
+		// a lone escape
+		return 1
+	}
+}
@@ -0,0 +1,339 @@
+package daemon
+
+import (
+	"bytes"
+	"regexp"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/api/types/backend"
+	"github.com/docker/docker/daemon/logger"
+)
+
+// StreamLogs reads logs from r, and sends them on msgs as ContainerLogs does
+// with the logs of a container, applying the options of config that work on
+// messages as they are read. It is for streaming logs that don't come from a
+// container, or for testing the stream on its own.
+//
+// readConfig is used as is, so it should start reading no later than config
+// asks for. StreamLogs blocks until the stream ends, and always closes msgs.
+// It only returns an error if config is invalid, in which case nothing is
+// sent.
+func StreamLogs(ctx context.Context, r logger.LogReader, readConfig logger.ReadConfig, config *backend.ContainerLogsConfig, msgs chan<- *backend.LogMessage) error {
+	if err := validateLogsConfig(config); err != nil {
+		close(msgs)
+		return err
+	}
+	stream, err := newLogStream(config)
+	if err != nil {
+		close(msgs)
+		return err
+	}
+	stream.run(ctx, r, readConfig, msgs)
+	return nil
+}
+
+// logStream holds what is needed to turn the messages read from a logger
+// into the messages of a log stream
+type logStream struct {
+	config *backend.ContainerLogsConfig
+	lg     *logrus.Entry
+
+	// since is where the stream starts, for sources without their own
+	// since in sourceSince
+	since       time.Time
+	sourceSince map[string]time.Time
+	// position is where the stream is in the logs. it starts at the cursor
+	// the stream resumes from, if there is one
+	position logCursor
+	windows  logWindows
+
+	errorPattern *regexp.Regexp
+	stopPattern  *regexp.Regexp
+	// escape sequences are stripped separately for each stream, since a
+	// sequence can be split over messages
+	strippers map[string]*ansiStripper
+	dedup     *logDeduper
+
+	// notices are sent before any logs
+	notices []*backend.LogMessage
+	// exitMessage, if set, returns the message reporting the exit of
+	// whatever was logging, once the logs of a followed stream end
+	exitMessage func(context.Context) *backend.LogMessage
+	// closeLogger, if set, is called once reading is done, to close a
+	// logger that was only created to be read
+	closeLogger func()
+}
+
+// newLogStream sets up a stream for the config, which must already be valid
+func newLogStream(config *backend.ContainerLogsConfig) (*logStream, error) {
+	s := &logStream{
+		config: config,
+		lg:     logrus.WithField("module", "daemon"),
+	}
+
+	var err error
+	if config.Since != "" {
+		s.since, err = parseLogTime(config.Since, config.TimeLayouts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// resuming from a cursor means reading from the time of the last message
+	// read, and skipping the messages at that time that were already read
+	if config.Cursor != "" {
+		s.position, err = parseLogCursor(config.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		s.since = s.position.timestamp
+	}
+
+	s.windows, err = parseLogWindows(config.Windows, config.TimeLayouts)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.windows) > 0 {
+		// the windows are sorted, so reading starts with the earliest one
+		s.since = s.windows[0].since
+	}
+
+	s.sourceSince, err = parseSourceSince(config.SourceSince, config.TimeLayouts)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.ErrorsOnly {
+		s.errorPattern = compileLogErrorPattern(config.ErrorPattern)
+	}
+	if config.StopOnMatch != "" {
+		// already validated
+		s.stopPattern = regexp.MustCompile(config.StopOnMatch)
+	}
+	if config.StripANSI {
+		s.strippers = make(map[string]*ansiStripper)
+	}
+	if config.DedupWindow > 0 {
+		s.dedup = newLogDeduper(config.DedupWindow)
+	}
+	return s, nil
+}
+
+// readSince returns the time reading has to start from for the stream.
+// sources with their own since are filtered as they are read, so reading has
+// to start early enough for all of them
+func (s *logStream) readSince() time.Time {
+	since := s.since
+	for _, t := range s.sourceSince {
+		if t.Before(since) {
+			since = t
+		}
+	}
+	return since
+}
+
+// run reads the logs from r, and sends them on msgs until the logs end or the
+// context is done, and then closes msgs
+func (s *logStream) run(ctx context.Context, r logger.LogReader, readConfig logger.ReadConfig, msgs chan<- *backend.LogMessage) {
+	config := s.config
+	lg := s.lg
+	logs := r.ReadLogs(readConfig)
+
+	// set up some defers. close the messages channel last: closing is the
+	// only way to signal above that we're doing with logs (other than
+	// context cancel i guess), and by then the logger must be done with.
+	defer close(msgs)
+
+	// closing the watcher can't fail, it only signals the reader to stop.
+	// logs is replaced when reading resumes, so the logger can only be
+	// closed once the last watcher is
+	defer func() {
+		logs.Close()
+		lg.Debug("closed log watcher")
+		if s.closeLogger != nil {
+			s.closeLogger()
+		}
+	}()
+
+	var recycler *messageRecycler
+	if config.ReuseMessages {
+		recycler = newMessageRecycler(cap(msgs))
+	}
+
+	// the number of messages at the time of the cursor still to be skipped
+	skip := s.position.count
+	// the timestamp of the last message sent, for MonotonicTimestamps
+	var lastTimestamp time.Time
+	// how many times reading has been resumed after transient errors
+	var retries int
+
+	// sendFinal sends the messages that end a stream that wasn't canceled.
+	// exited is true if the stream ended because the logs did
+	sendFinal := func(exited bool) {
+		var final []*backend.LogMessage
+		if exited && readConfig.Follow && s.exitMessage != nil {
+			if m := s.exitMessage(ctx); m != nil {
+				final = append(final, m)
+			}
+		}
+		if config.ReportCursor {
+			final = append(final, s.position.message())
+		}
+		for _, m := range final {
+			select {
+			case <-ctx.Done():
+				return
+			case msgs <- m:
+			}
+		}
+	}
+
+	lg.Debug("begin logs")
+	for _, m := range s.notices {
+		select {
+		case <-ctx.Done():
+			return
+		case msgs <- m:
+		}
+	}
+	for {
+		select {
+		// i do not believe as the system is currently designed any error is
+		// possible, but we should be prepared to handle it anyway. if we do
+		// get an error, copy only the error field to a new object so we
+		// don't end up with partial data in the other fields
+		case err := <-logs.Err:
+			if logger.IsTransientReadError(err) && retries < config.ReadRetries {
+				retries++
+				lg.WithError(err).Warnf("Transient error streaming logs, resuming (retry %d of %d)", retries, config.ReadRetries)
+				logs.Close()
+				resumeConfig := readConfig
+				if !s.position.timestamp.IsZero() {
+					// pick up right after the last message read
+					resumeConfig.Since = s.position.timestamp
+					resumeConfig.Tail = -1
+					skip = s.position.count
+				}
+				logs = r.ReadLogs(resumeConfig)
+				continue
+			}
+			lg.Errorf("Error streaming logs: %v", err)
+			select {
+			case <-ctx.Done():
+			case msgs <- &backend.LogMessage{Err: err}:
+			}
+			return
+		case <-ctx.Done():
+			lg.Debugf("logs: end stream, ctx is done: %v", ctx.Err())
+			return
+		case msg, ok := <-logs.Msg:
+			// messages that are dropped here go back to the pool right away
+			// if messages are reused, and sent messages are handed to the
+			// recycler, which puts them back once the consumer is done with
+			// them
+			if !ok {
+				lg.Debug("end logs")
+				sendFinal(true)
+				return
+			}
+			m := msg.AsLogMessage() // just a pointer conversion, does not copy data
+			if skip > 0 && m.Timestamp.Equal(s.position.timestamp) {
+				skip--
+				recycler.drop(msg)
+				continue
+			}
+			skip = 0
+			s.position.advance(m.Timestamp)
+			if !s.keep(m) {
+				recycler.drop(msg)
+				continue
+			}
+
+			if config.DropPartialMetadata {
+				m.Partial = false
+			}
+
+			if config.MonotonicTimestamps {
+				if m.Timestamp.Before(lastTimestamp) {
+					clampTimestamp(m, lastTimestamp)
+				}
+				lastTimestamp = m.Timestamp
+			}
+
+			// a line matching the stop pattern is sent, and then the stream
+			// ends
+			stop := s.stopPattern != nil && s.stopPattern.Match(m.Line)
+
+			// try the send without blocking first, so that we only pay for
+			// timing it when the consumer isn't keeping up
+			select {
+			case msgs <- m:
+				recycler.sent(msg)
+				if stop {
+					lg.Debug("end logs, stop pattern matched")
+					sendFinal(false)
+					return
+				}
+				continue
+			default:
+			}
+
+			// there could be a case where the reader stops accepting
+			// messages and the context is canceled. we need to check that
+			// here, or otherwise we risk blocking forever on the message
+			// send.
+			start := time.Now()
+			select {
+			case <-ctx.Done():
+				return
+			case msgs <- m:
+			}
+			recycler.sent(msg)
+			blocked := time.Since(start)
+			logsBackpressureTimer.Update(blocked)
+			if config.Backpressure != nil {
+				config.Backpressure(blocked)
+			}
+			if stop {
+				lg.Debug("end logs, stop pattern matched")
+				sendFinal(false)
+				return
+			}
+		}
+	}
+}
+
+// keep returns false if the message is filtered out of the stream. it strips
+// escape sequences from messages that are kept, if the stream does that
+func (s *logStream) keep(m *backend.LogMessage) bool {
+	if s.dedup != nil && s.dedup.seenRecently(m) {
+		return false
+	}
+	if len(s.windows) > 0 && !s.windows.contain(m.Timestamp) {
+		return false
+	}
+	if s.sourceSince != nil && beforeSourceSince(m, s.since, s.sourceSince) {
+		return false
+	}
+	if s.strippers != nil {
+		stripper, ok := s.strippers[m.Source]
+		if !ok {
+			stripper = &ansiStripper{}
+			s.strippers[m.Source] = stripper
+		}
+		// messages read back from files don't keep the partial flag, but a
+		// partial line is one without a newline
+		partial := m.Partial || !bytes.HasSuffix(m.Line, []byte("\n"))
+		m.Line = stripper.strip(m.Line, partial)
+		if len(m.Line) == 0 && partial {
+			return false
+		}
+	}
+	if s.errorPattern != nil && m.Source == "stdout" && !s.errorPattern.Match(m.Line) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/backend"
+	"github.com/docker/docker/daemon/logger"
+)
+
+func TestStreamLogs(t *testing.T) {
+	ts := time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC)
+	r := &fixedLogReader{msgs: []*logger.Message{
+		{Line: []byte("a\n"), Source: "stdout", Timestamp: ts},
+		{Line: []byte("b\n"), Source: "stdout", Timestamp: ts.Add(time.Second)},
+		{Line: []byte("c\n"), Source: "stdout", Timestamp: ts.Add(2 * time.Second)},
+	}}
+
+	msgs := make(chan *backend.LogMessage)
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, StopOnMatch: "^b", ReportCursor: true}
+	done := make(chan error)
+	go func() {
+		done <- StreamLogs(context.Background(), r, logger.ReadConfig{Tail: -1}, config, msgs)
+	}()
+	read := readLogMessages(t, msgs)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 3 || string(read[0].Line) != "a\n" || string(read[1].Line) != "b\n" {
+		t.Fatalf("expected the messages up to the stop pattern, got %v", read)
+	}
+	if read[2].Source != backend.LogSourceCursor {
+		t.Fatalf("expected a cursor at the end, got %v", read[2])
+	}
+}
+
+func TestStreamLogsCanceled(t *testing.T) {
+	r := &fixedLogReader{msgs: []*logger.Message{{Line: []byte("a\n"), Source: "stdout"}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	msgs := make(chan *backend.LogMessage)
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}}
+	if err := StreamLogs(ctx, r, logger.ReadConfig{Tail: -1}, config, msgs); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-msgs; ok {
+		t.Fatal("expected the stream to be closed without sending anything")
+	}
+}
+
+func TestStreamLogsInvalidConfig(t *testing.T) {
+	msgs := make(chan *backend.LogMessage)
+	if err := StreamLogs(context.Background(), &fixedLogReader{}, logger.ReadConfig{}, &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{}}, msgs); err == nil {
+		t.Fatal("expected an error for a config showing neither stdout nor stderr")
+	}
+	if _, ok := <-msgs; ok {
+		t.Fatal("expected the messages channel to be closed")
+	}
+}
+
+func TestStreamLogsBackpressure(t *testing.T) {
+	r := &fixedLogReader{msgs: []*logger.Message{
+		{Line: []byte("a\n"), Source: "stdout"},
+		{Line: []byte("b\n"), Source: "stdout"},
+	}}
+
+	blocked := make(chan time.Duration, 2)
+	msgs := make(chan *backend.LogMessage)
+	config := &backend.ContainerLogsConfig{
+		ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true},
+		Backpressure:         func(d time.Duration) { blocked <- d },
+	}
+	go StreamLogs(context.Background(), r, logger.ReadConfig{Tail: -1}, config, msgs)
+
+	// a consumer that isn't ready holds up the stream
+	time.Sleep(50 * time.Millisecond)
+	read := readLogMessages(t, msgs)
+	if len(read) != 2 {
+		t.Fatalf("expected all the messages, got %v", read)
+	}
+	select {
+	case d := <-blocked:
+		if d < 10*time.Millisecond {
+			t.Fatalf("expected the stream to be blocked while the consumer wasn't reading, got %v", d)
+		}
+	default:
+		t.Fatal("expected backpressure to be reported")
+	}
+}
+
+func TestStreamLogsErrorsOnly(t *testing.T) {
+	r := &fixedLogReader{msgs: []*logger.Message{
+		{Line: []byte("fine\n"), Source: "stdout"},
+		{Line: []byte("request failed\n"), Source: "stdout"},
+		{Line: []byte("warning\n"), Source: "stderr"},
+	}}
+
+	// ErrorsOnly shows both streams, whatever the config says
+	msgs := make(chan *backend.LogMessage)
+	config := &backend.ContainerLogsConfig{ErrorsOnly: true}
+	done := make(chan error)
+	go func() {
+		done <- StreamLogs(context.Background(), r, logger.ReadConfig{Tail: -1}, config, msgs)
+	}()
+	read := readLogMessages(t, msgs)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 2 || string(read[0].Line) != "request failed\n" || string(read[1].Line) != "warning\n" {
+		t.Fatalf("expected the errors on stdout and all of stderr, got %v", read)
+	}
+}
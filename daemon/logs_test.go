@@ -1,9 +1,27 @@
 package daemon
 
 import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"golang.org/x/net/context"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/backend"
 	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/container"
+	"github.com/docker/docker/daemon/logger"
+	"github.com/docker/docker/daemon/logger/jsonfilelog"
+	"github.com/docker/docker/pkg/registrar"
+	"github.com/docker/docker/pkg/truncindex"
 )
 
 func TestMergeAndVerifyLogConfigNilConfig(t *testing.T) {
@@ -13,3 +31,1012 @@ func TestMergeAndVerifyLogConfigNilConfig(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestLogDeduperDropsDuplicatesInWindow(t *testing.T) {
+	now := time.Now()
+	msg := func(line string, offset time.Duration) *backend.LogMessage {
+		return &backend.LogMessage{Line: []byte(line), Source: "stdout", Timestamp: now.Add(offset)}
+	}
+
+	d := newLogDeduper(3)
+	for _, tc := range []struct {
+		msg  *backend.LogMessage
+		seen bool
+	}{
+		{msg("a", 0), false},
+		{msg("b", 1), false},
+		// interleaved redelivery of an earlier message
+		{msg("a", 0), true},
+		{msg("c", 2), false},
+		{msg("b", 1), true},
+		// the same line at a different time is a genuine repeat
+		{msg("a", 3), false},
+		// "a" at 0 has now fallen out of the window
+		{msg("a", 0), false},
+	} {
+		if seen := d.seenRecently(tc.msg); seen != tc.seen {
+			t.Fatalf("message %q at %v: expected seen=%v, got %v", tc.msg.Line, tc.msg.Timestamp.Sub(now), tc.seen, seen)
+		}
+	}
+}
+
+func TestLogDeduperDistinguishesSources(t *testing.T) {
+	now := time.Now()
+	d := newLogDeduper(10)
+	if d.seenRecently(&backend.LogMessage{Line: []byte("a"), Source: "stdout", Timestamp: now}) {
+		t.Fatal("first message should not be a duplicate")
+	}
+	if d.seenRecently(&backend.LogMessage{Line: []byte("a"), Source: "stderr", Timestamp: now}) {
+		t.Fatal("message on a different stream should not be a duplicate")
+	}
+}
+
+func TestMergeAndVerifyLogConfigSecondary(t *testing.T) {
+	d := &Daemon{defaultLogConfig: containertypes.LogConfig{Type: "json-file"}}
+
+	cfg := containertypes.LogConfig{
+		Type:      "json-file",
+		Secondary: []containertypes.LogConfig{{Type: "syslog"}},
+	}
+	if err := d.mergeAndVerifyLogConfig(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Secondary[0].Config == nil {
+		t.Fatal("expected secondary config to be initialized")
+	}
+
+	for _, secondary := range [][]containertypes.LogConfig{
+		{{Type: ""}},
+		{{Type: "none"}},
+		{{Type: "json-file"}},
+		{{Type: "syslog"}, {Type: "syslog"}},
+		{{Type: "syslog", Secondary: []containertypes.LogConfig{{Type: "json-file"}}}},
+		{{Type: "syslog", Config: map[string]string{"not-an-option": "1"}}},
+		{{Type: "no-such-driver"}},
+	} {
+		cfg := containertypes.LogConfig{Type: "json-file", Secondary: secondary}
+		if err := d.mergeAndVerifyLogConfig(&cfg); err == nil {
+			t.Fatalf("expected error for secondary log config %+v", secondary)
+		}
+	}
+}
+
+func TestValidateLogsConfig(t *testing.T) {
+	valid := []backend.ContainerLogsConfig{
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStderr: true}},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Details: true}, DetailsJSON: true},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Details: true}, IncludeSource: true},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, TailBuffer: 10},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Follow: true}, DedupWindow: 10, MessageBuffer: 10},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, StripEmbeddedTimestamp: `\d{4}-\d{2}-\d{2}`},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Tail: "all"}, Cursor: logCursor{}.String()},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, ByteStart: 10, ByteEnd: 20},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, ByteEnd: 20},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, Windows: []backend.LogTimeWindow{{Since: "10", Until: "20"}, {Since: "5"}}},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, SourceStreams: map[string]string{"console": "stdout", "app": "stderr", "stdout": ""}},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, LineEndings: "crlf"},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Tail: "10"}, TailBytes: 1024},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Since: "01/May/2017:10:00:00 +0000"}, TimeLayouts: []string{"02/Jan/2006:15:04:05 -0700"}},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, ErrorsOnly: true, ErrorPattern: "^E"},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Tail: "all"}, LineStart: 1000, LineCount: 1000},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Follow: true}, ReadRetries: 3},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Since: "10"}, SourceSince: map[string]string{"stderr": "0"}},
+	}
+	for _, config := range valid {
+		if err := validateLogsConfig(&config); err != nil {
+			t.Fatalf("unexpected error for %+v: %v", config, err)
+		}
+	}
+
+	invalid := []backend.ContainerLogsConfig{
+		{ContainerLogsOptions: types.ContainerLogsOptions{}},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, DetailsJSON: true},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, IncludeSource: true},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, TailBuffer: -1},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Follow: true}, TailBuffer: 10},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, DedupWindow: -1},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, MessageBuffer: -1},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, StripEmbeddedTimestamp: "[0-9"},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Details: true}, DetailKeys: []string{"a"}, DetailExcludeKeys: []string{"b"}},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, Cursor: "not a cursor"},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Since: "10"}, Cursor: logCursor{}.String()},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Tail: "10"}, Cursor: logCursor{}.String()},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, ByteStart: -1},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, ByteStart: 20, ByteEnd: 10},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Follow: true}, ByteStart: 10},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Tail: "5"}, ByteStart: 10},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, Windows: []backend.LogTimeWindow{{Until: "20"}}},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, Windows: []backend.LogTimeWindow{{Since: "20", Until: "10"}}},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Since: "5"}, Windows: []backend.LogTimeWindow{{Since: "10"}}},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, SourceStreams: map[string]string{"console": "stdin"}},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, LineEndings: "cr"},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, TailBytes: -1},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, TailBytes: 1024, ByteStart: 10},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Since: "01/May/2017:10:00:00 +0000"}},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, ErrorPattern: "^E"},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, ErrorsOnly: true, ErrorPattern: "(E"},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, LineStart: -1},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Follow: true}, LineCount: 10},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Tail: "10"}, LineCount: 10},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, LineCount: 10, ByteEnd: 10},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, ReadRetries: -1},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, RotateSize: -1},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, RotateInterval: -time.Second},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, SourceSince: map[string]string{"stderr": "not a time"}},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, SourceSince: map[string]string{"stderr": "1"}, Cursor: logCursor{}.String()},
+		{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, ReadRetries: 1, LineCount: 10},
+	}
+	for _, config := range invalid {
+		if err := validateLogsConfig(&config); err == nil {
+			t.Fatalf("expected error for %+v", config)
+		}
+	}
+}
+
+func TestNameHistory(t *testing.T) {
+	var h nameHistory
+	if ids := h.get("/foo"); len(ids) != 0 {
+		t.Fatalf("expected no history, got %v", ids)
+	}
+	for i := 0; i < maxNameHistory+2; i++ {
+		h.add("/foo", strconv.Itoa(i))
+	}
+	h.add("/bar", "bar")
+
+	ids := h.get("/foo")
+	if len(ids) != maxNameHistory {
+		t.Fatalf("expected history to be capped at %d, got %d", maxNameHistory, len(ids))
+	}
+	if ids[0] != strconv.Itoa(maxNameHistory+1) || ids[len(ids)-1] != "2" {
+		t.Fatalf("expected most recent first, got %v", ids)
+	}
+}
+
+func TestGetLogsContainerPreviousInstance(t *testing.T) {
+	d := &Daemon{
+		containers: container.NewMemoryStore(),
+		idIndex:    truncindex.NewTruncIndex(nil),
+		nameIndex:  registrar.NewRegistrar(),
+	}
+	d.nameHistory.add("/foo", "removed")
+
+	for _, name := range []string{"foo^0", "foo^x", "foo^2"} {
+		if _, err := d.getLogsContainer(name); err == nil {
+			t.Fatalf("expected error for %s", name)
+		}
+	}
+	_, err := d.getLogsContainer("foo^1")
+	if err == nil || !strings.Contains(err.Error(), "removed") {
+		t.Fatalf("expected error about removed container, got %v", err)
+	}
+	// a container renamed from the name is found
+	c := container.NewBaseContainer("a7317399f3f857173c6179d44823594f8294678dea9999662e5c625b5a1c7657", "")
+	c.Name = "/bar"
+	d.containers.Add(c.ID, c)
+	d.nameHistory.add("/foo", c.ID)
+	found, err := d.getLogsContainer("foo^1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.ID != c.ID {
+		t.Fatalf("expected the renamed container, got %s", found.ID)
+	}
+}
+
+func TestLogCursor(t *testing.T) {
+	ts := time.Unix(1494000000, 123456789)
+	var c logCursor
+	c.advance(ts.Add(-time.Second))
+	c.advance(ts)
+	c.advance(ts)
+	if c.count != 2 {
+		t.Fatalf("expected count of 2 messages at the last timestamp, got %d", c.count)
+	}
+
+	parsed, err := parseLogCursor(c.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parsed.timestamp.Equal(ts) || parsed.count != 2 {
+		t.Fatalf("expected cursor to round trip, got %+v", parsed)
+	}
+
+	m := c.message()
+	if m.Source != backend.LogSourceCursor || m.Attrs["cursor"] != c.String() {
+		t.Fatalf("unexpected cursor message %+v", m)
+	}
+
+	for _, invalid := range []string{"", "!!", "MTIz", "eDox", "MTotMQ"} {
+		if _, err := parseLogCursor(invalid); err == nil {
+			t.Fatalf("expected error parsing cursor %q", invalid)
+		}
+	}
+}
+
+func TestLogWindows(t *testing.T) {
+	windows, err := parseLogWindows([]backend.LogTimeWindow{
+		{Since: "300", Until: "400"},
+		{Since: "100", Until: "200"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !windows[0].since.Equal(time.Unix(100, 0)) {
+		t.Fatalf("expected windows sorted by start, got %v", windows)
+	}
+
+	for _, tc := range []struct {
+		sec int64
+		in  bool
+	}{
+		{50, false},
+		{100, true},
+		{150, true},
+		{200, true},
+		{250, false},
+		{350, true},
+		{450, false},
+	} {
+		if windows.contain(time.Unix(tc.sec, 0)) != tc.in {
+			t.Fatalf("expected contain(%d) to be %v", tc.sec, tc.in)
+		}
+	}
+
+	open, err := parseLogWindows([]backend.LogTimeWindow{{Since: "100"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !open.contain(time.Unix(1<<40, 0)) {
+		t.Fatal("expected window without an end to be open ended")
+	}
+}
+
+func TestParseLogTime(t *testing.T) {
+	layouts := []string{"02/Jan/2006:15:04:05 -0700", "2006-01-02 15:04"}
+	expected := time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC)
+	for _, value := range []string{
+		"01/May/2017:10:00:00 +0000",
+		"2017-05-01 10:00",
+		strconv.FormatInt(expected.Unix(), 10),
+	} {
+		ts, err := parseLogTime(value, layouts)
+		if err != nil {
+			t.Fatalf("%s: %v", value, err)
+		}
+		if !ts.Equal(expected) {
+			t.Fatalf("%s: expected %v, got %v", value, expected, ts)
+		}
+	}
+
+	if _, err := parseLogTime("yesterday", layouts); err == nil {
+		t.Fatal("expected error for a time matching no layout")
+	}
+}
+
+func TestDefaultLogErrorPattern(t *testing.T) {
+	pattern := compileLogErrorPattern("")
+	for _, line := range []string{
+		"ERROR: disk full",
+		"request failed after 3 retries",
+		"panic: runtime error",
+		"java.lang.NullPointerException: Exception in thread main",
+	} {
+		if !pattern.MatchString(line) {
+			t.Fatalf("expected %q to match", line)
+		}
+	}
+	for _, line := range []string{
+		"GET /errors 200",
+		"no problems here",
+	} {
+		if pattern.MatchString(line) {
+			t.Fatalf("expected %q not to match", line)
+		}
+	}
+}
+
+// newLogsTestDaemon returns a daemon with a single container using the
+// json-file log driver, which has logged the given lines. if running is
+// false, the logger is closed, like that of a stopped container.
+func newLogsTestDaemon(t testing.TB, running bool, lines ...string) (*Daemon, *container.Container, func()) {
+	tmp, err := ioutil.TempDir("", "docker-logs-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := container.NewBaseContainer("a7317399f3f857173c6179d44823594f8294678dea9999662e5c625b5a1c7657", tmp)
+	c.Config = &containertypes.Config{}
+	c.HostConfig = &containertypes.HostConfig{LogConfig: containertypes.LogConfig{Type: "json-file"}}
+	c.LogPath = filepath.Join(tmp, c.ID+"-json.log")
+	l, err := jsonfilelog.New(logger.Info{ContainerID: c.ID, LogPath: c.LogPath})
+	if err != nil {
+		os.RemoveAll(tmp)
+		t.Fatal(err)
+	}
+	for _, line := range lines {
+		if err := l.Log(&logger.Message{Line: []byte(line), Source: "stdout", Timestamp: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if running {
+		c.LogDriver = l
+		c.State.Running = true
+	} else {
+		l.Close()
+	}
+
+	d := &Daemon{
+		containers: container.NewMemoryStore(),
+		idIndex:    truncindex.NewTruncIndex(nil),
+		nameIndex:  registrar.NewRegistrar(),
+	}
+	d.containers.Add(c.ID, c)
+	return d, c, func() {
+		l.Close()
+		os.RemoveAll(tmp)
+	}
+}
+
+// readLogMessages reads messages until the channel is closed
+func readLogMessages(t *testing.T, msgs <-chan *backend.LogMessage) []*backend.LogMessage {
+	var read []*backend.LogMessage
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case m, ok := <-msgs:
+			if !ok {
+				return read
+			}
+			read = append(read, m)
+		case <-timeout:
+			t.Fatalf("timeout waiting for the stream to end, got %d messages", len(read))
+		}
+	}
+}
+
+func TestContainerLogsStopOnMatch(t *testing.T) {
+	d, c, cleanup := newLogsTestDaemon(t, true, "starting", "ready", "serving")
+	defer cleanup()
+
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Follow: true}, StopOnMatch: "^ready"}
+	msgs, err := d.ContainerLogs(context.Background(), c.ID, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := readLogMessages(t, msgs)
+	if len(read) != 2 || string(read[0].Line) != "starting\n" || string(read[1].Line) != "ready\n" {
+		t.Fatalf("expected the stream to end with the matching line, got %v", read)
+	}
+}
+
+func TestANSIStripper(t *testing.T) {
+	for _, tc := range []struct {
+		line, expected string
+	}{
+		{"plain\n", "plain\n"},
+		{"\x1b[1;31mred\x1b[0m\n", "red\n"},
+		{"\x1b]0;title\x07text\n", "text\n"},
+		{"\x1b]8;;http://example.com\x1b\\link\x1b]8;;\x1b\\\n", "link\n"},
+		{"\x1b(Bcharset\n", "charset\n"},
+		{"\x1b7saved\x1b8\n", "saved\n"},
+		// an invalid sequence is cut short, keeping the text after it
+		{"\x1b[12\nnext", "\nnext"},
+		// a sequence that can't be finished is left alone
+		{"end\x1b[1", "end\x1b[1"},
+	} {
+		var s ansiStripper
+		if out := string(s.strip([]byte(tc.line), false)); out != tc.expected {
+			t.Fatalf("%q: expected %q, got %q", tc.line, tc.expected, out)
+		}
+	}
+
+	// a sequence split over partial messages is held back and finished
+	var s ansiStripper
+	var out []byte
+	for _, part := range []string{"a\x1b", "[1;3", "1mb\x1b]0;ti", "tle\x07c\n"} {
+		out = append(out, s.strip([]byte(part), !strings.HasSuffix(part, "\n"))...)
+	}
+	if string(out) != "abc\n" {
+		t.Fatalf("expected split sequences to be stripped, got %q", out)
+	}
+}
+
+func TestContainerLogsReportExit(t *testing.T) {
+	d, c, cleanup := newLogsTestDaemon(t, true, "working")
+	defer cleanup()
+
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Follow: true}, ReportExit: true}
+	msgs, err := d.ContainerLogs(context.Background(), c.ID, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-msgs:
+		if string(m.Line) != "working\n" {
+			t.Fatalf("unexpected message %+v", m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the logs")
+	}
+
+	// killed by SIGKILL
+	c.Lock()
+	c.SetStopped(&container.ExitStatus{ExitCode: 137})
+	c.Unlock()
+	c.LogDriver.Close()
+
+	read := readLogMessages(t, msgs)
+	if len(read) != 1 {
+		t.Fatalf("expected only the exit message, got %v", read)
+	}
+	exit := read[0]
+	if exit.Source != backend.LogSourceExit || exit.Attrs["exitCode"] != "137" {
+		t.Fatalf("unexpected exit message %+v", exit)
+	}
+	if runtime.GOOS != "windows" && exit.Attrs["signal"] != "9" {
+		t.Fatalf("expected the exit message to report signal 9, got %+v", exit)
+	}
+	if !exit.Timestamp.Equal(c.FinishedAt) {
+		t.Fatalf("expected the exit message at %v, got %v", c.FinishedAt, exit.Timestamp)
+	}
+}
+
+func TestContainerLogsMessageBuffer(t *testing.T) {
+	d, c, cleanup := newLogsTestDaemon(t, false, "hello")
+	defer cleanup()
+
+	for _, tc := range []struct {
+		buffer, expected int
+	}{
+		// no buffer keeps the default of one message
+		{0, 1},
+		{1, 1},
+		{10, 10},
+	} {
+		config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, MessageBuffer: tc.buffer}
+		msgs, err := d.ContainerLogs(context.Background(), c.ID, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cap(msgs) != tc.expected {
+			t.Fatalf("message buffer %d: expected a channel capacity of %d, got %d", tc.buffer, tc.expected, cap(msgs))
+		}
+		readLogMessages(t, msgs)
+	}
+}
+
+func TestContainerLogsFollowNotRunning(t *testing.T) {
+	d, c, cleanup := newLogsTestDaemon(t, false, "done")
+	defer cleanup()
+
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Follow: true}, StrictFollow: true}
+	if _, err := d.ContainerLogs(context.Background(), c.ID, config); err == nil {
+		t.Fatal("expected an error following a stopped container in strict mode")
+	}
+
+	// without notices, there are only the logs
+	config.StrictFollow = false
+	msgs, err := d.ContainerLogs(context.Background(), c.ID, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := readLogMessages(t, msgs)
+	if len(read) != 1 || string(read[0].Line) != "done\n" {
+		t.Fatalf("expected only the logs, got %v", read)
+	}
+
+	config.ReportNotices = true
+	msgs, err = d.ContainerLogs(context.Background(), c.ID, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read = readLogMessages(t, msgs)
+	if len(read) != 2 {
+		t.Fatalf("expected a notice and the logs, got %v", read)
+	}
+	if read[0].Source != backend.LogSourceNotice || read[0].Attrs["reason"] != "follow-not-running" {
+		t.Fatalf("expected the stream to start with a notice, got %+v", read[0])
+	}
+	if string(read[1].Line) != "done\n" {
+		t.Fatalf("unexpected message %+v", read[1])
+	}
+}
+
+func TestContainerLogConfig(t *testing.T) {
+	d := &Daemon{
+		containers: container.NewMemoryStore(),
+		idIndex:    truncindex.NewTruncIndex(nil),
+		nameIndex:  registrar.NewRegistrar(),
+		defaultLogConfig: containertypes.LogConfig{
+			Type:   "json-file",
+			Config: map[string]string{"max-size": "10m", "max-file": "2"},
+		},
+	}
+	c := container.NewBaseContainer("a7317399f3f857173c6179d44823594f8294678dea9999662e5c625b5a1c7657", "")
+	c.HostConfig = &containertypes.HostConfig{
+		LogConfig: containertypes.LogConfig{Config: map[string]string{"max-file": "5"}},
+	}
+	d.containers.Add(c.ID, c)
+
+	cfg, err := d.ContainerLogConfig(c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Type != "json-file" || cfg.Config["max-size"] != "10m" || cfg.Config["max-file"] != "5" {
+		t.Fatalf("expected the defaults to be merged in, got %+v", cfg)
+	}
+	if c.HostConfig.LogConfig.Type != "" || len(c.HostConfig.LogConfig.Config) != 1 {
+		t.Fatalf("expected the container's config to be left alone, got %+v", c.HostConfig.LogConfig)
+	}
+}
+
+func TestClampTimestamp(t *testing.T) {
+	original := time.Date(2017, 5, 1, 10, 0, 0, 5, time.UTC)
+	later := original.Add(time.Millisecond)
+	attrs := backend.LogAttributes{"a": "1"}
+	m := &backend.LogMessage{Timestamp: original, Attrs: attrs}
+
+	clampTimestamp(m, later)
+	if !m.Timestamp.Equal(later) {
+		t.Fatalf("expected timestamp to be moved to %v, got %v", later, m.Timestamp)
+	}
+	if m.Attrs["originalTimestamp"] != "2017-05-01T10:00:00.000000005Z" || m.Attrs["a"] != "1" {
+		t.Fatalf("unexpected attributes %v", m.Attrs)
+	}
+	if _, ok := attrs["originalTimestamp"]; ok {
+		t.Fatal("expected the original attributes to be left alone")
+	}
+}
+
+// flakyLogReader is a log reader that fails with a transient error at the
+// third message the first time it is read
+type flakyLogReader struct {
+	msgs  []*logger.Message
+	reads []logger.ReadConfig
+	// closed is set once the logger is closed, and readClosed if it is read
+	// after that
+	closed     bool
+	readClosed bool
+}
+
+func (l *flakyLogReader) Log(*logger.Message) error { return nil }
+func (l *flakyLogReader) Name() string              { return "flaky" }
+
+func (l *flakyLogReader) Close() error {
+	l.closed = true
+	return nil
+}
+
+func (l *flakyLogReader) ReadLogs(config logger.ReadConfig) *logger.LogWatcher {
+	l.reads = append(l.reads, config)
+	l.readClosed = l.readClosed || l.closed
+	first := len(l.reads) == 1
+	w := logger.NewLogWatcher()
+	go func() {
+		defer close(w.Msg)
+		for i, m := range l.msgs {
+			if m.Timestamp.Before(config.Since) {
+				continue
+			}
+			if first && i == 2 {
+				w.Err <- logger.TransientReadError{Err: errors.New("log file missing")}
+				<-w.WatchClose()
+				return
+			}
+			select {
+			case w.Msg <- &logger.Message{Line: m.Line, Source: m.Source, Timestamp: m.Timestamp}:
+			case <-w.WatchClose():
+				return
+			}
+		}
+	}()
+	return w
+}
+
+func TestContainerLogsResumeAfterTransientError(t *testing.T) {
+	ts := time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC)
+	l := &flakyLogReader{msgs: []*logger.Message{
+		{Line: []byte("a\n"), Source: "stdout", Timestamp: ts},
+		{Line: []byte("b\n"), Source: "stdout", Timestamp: ts.Add(time.Second)},
+		{Line: []byte("c\n"), Source: "stdout", Timestamp: ts.Add(time.Second)},
+		{Line: []byte("d\n"), Source: "stdout", Timestamp: ts.Add(2 * time.Second)},
+	}}
+	c := container.NewBaseContainer("a7317399f3f857173c6179d44823594f8294678dea9999662e5c625b5a1c7657", "")
+	c.HostConfig = &containertypes.HostConfig{LogConfig: containertypes.LogConfig{Type: "flaky"}}
+	c.LogDriver = l
+	c.State.Running = true
+	d := &Daemon{
+		containers: container.NewMemoryStore(),
+		idIndex:    truncindex.NewTruncIndex(nil),
+		nameIndex:  registrar.NewRegistrar(),
+	}
+	d.containers.Add(c.ID, c)
+
+	msgs, err := d.ContainerLogs(context.Background(), c.ID, &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, ReadRetries: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, m := range readLogMessages(t, msgs) {
+		if m.Err != nil {
+			t.Fatalf("unexpected error %v", m.Err)
+		}
+		lines = append(lines, string(m.Line))
+	}
+	if strings.Join(lines, "") != "a\nb\nc\nd\n" {
+		t.Fatalf("expected every message exactly once, got %q", lines)
+	}
+	// messages the reader had buffered when it failed may or may not have
+	// been read, so reading resumes from either of them
+	if len(l.reads) != 2 || l.reads[1].Since.Before(ts) || l.reads[1].Since.After(ts.Add(time.Second)) {
+		t.Fatalf("expected reading to resume from the last message read, got %+v", l.reads)
+	}
+}
+
+func TestLogStreamClosesLoggerAfterReading(t *testing.T) {
+	ts := time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC)
+	l := &flakyLogReader{msgs: []*logger.Message{
+		{Line: []byte("a\n"), Source: "stdout", Timestamp: ts},
+		{Line: []byte("b\n"), Source: "stdout", Timestamp: ts.Add(time.Second)},
+		{Line: []byte("c\n"), Source: "stdout", Timestamp: ts.Add(2 * time.Second)},
+	}}
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, ReadRetries: 1}
+	stream, err := newLogStream(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.lg = logrus.NewEntry(logrus.StandardLogger())
+	stream.closeLogger = func() { l.Close() }
+
+	msgs := make(chan *backend.LogMessage, 1)
+	go stream.run(context.Background(), l, logger.ReadConfig{Tail: -1}, msgs)
+	readLogMessages(t, msgs)
+	if len(l.reads) != 2 {
+		t.Fatalf("expected reading to be resumed once, got %d reads", len(l.reads))
+	}
+	if !l.closed {
+		t.Fatal("expected the logger to be closed once the stream ended")
+	}
+	if l.readClosed {
+		t.Fatal("expected the logger to be closed only once reading was done")
+	}
+}
+
+func TestMessageRecycler(t *testing.T) {
+	// with a buffer of one message, a message can be in the buffer and
+	// another held by the consumer, so only the third to last is put back
+	r := newMessageRecycler(1)
+	var sent []*logger.Message
+	for _, line := range []string{"one", "two", "three"} {
+		m := logger.NewMessage()
+		m.Line = append(m.Line, line...)
+		r.sent(m)
+		sent = append(sent, m)
+	}
+	if len(sent[0].Line) != 0 {
+		t.Fatalf("expected the first message to be put back, got %q", sent[0].Line)
+	}
+	if string(sent[1].Line) != "two" || string(sent[2].Line) != "three" {
+		t.Fatalf("expected the last two messages to be left alone, got %q and %q", sent[1].Line, sent[2].Line)
+	}
+
+	// a nil recycler does nothing
+	var nilRecycler *messageRecycler
+	nilRecycler.sent(sent[2])
+	nilRecycler.drop(sent[2])
+	if string(sent[2].Line) != "three" {
+		t.Fatalf("expected a nil recycler to leave messages alone, got %q", sent[2].Line)
+	}
+}
+
+func TestContainerLogsReuseMessages(t *testing.T) {
+	var lines []string
+	for i := 0; i < 100; i++ {
+		lines = append(lines, "line "+strconv.Itoa(i))
+	}
+	d, c, cleanup := newLogsTestDaemon(t, false, lines...)
+	defer cleanup()
+
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, ReuseMessages: true}
+	msgs, err := d.ContainerLogs(context.Background(), c.ID, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the lines must be copied before the next receive
+	var read []string
+	for m := range msgs {
+		read = append(read, string(m.Line))
+	}
+	if len(read) != len(lines) {
+		t.Fatalf("expected %d messages, got %d", len(lines), len(read))
+	}
+	for i, line := range read {
+		if line != lines[i]+"\n" {
+			t.Fatalf("message %d: expected %q, got %q", i, lines[i]+"\n", line)
+		}
+	}
+}
+
+func BenchmarkContainerLogs(b *testing.B) {
+	var lines []string
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, strings.Repeat("x", 100)+strconv.Itoa(i))
+	}
+	d, c, cleanup := newLogsTestDaemon(b, false, lines...)
+	defer cleanup()
+
+	for _, reuse := range []bool{false, true} {
+		b.Run("reuse="+strconv.FormatBool(reuse), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, ReuseMessages: reuse}
+				msgs, err := d.ContainerLogs(context.Background(), c.ID, config)
+				if err != nil {
+					b.Fatal(err)
+				}
+				for range msgs {
+				}
+			}
+		})
+	}
+}
+
+// stubReaderLogger is a logger with a ReadLogs that reads nothing, which says
+// so in its capabilities
+type stubReaderLogger struct{}
+
+func (stubReaderLogger) Log(*logger.Message) error { return nil }
+func (stubReaderLogger) Name() string              { return "stub" }
+func (stubReaderLogger) Close() error              { return nil }
+
+func (stubReaderLogger) ReadLogs(logger.ReadConfig) *logger.LogWatcher {
+	w := logger.NewLogWatcher()
+	close(w.Msg)
+	return w
+}
+
+func (stubReaderLogger) ReaderCapabilities() logger.ReaderCapabilities {
+	return logger.ReaderCapabilities{ReadUnsupported: true}
+}
+
+func TestContainerLogsReadUnsupported(t *testing.T) {
+	d, c, cleanup := newLogsTestDaemon(t, true, "hello")
+	defer cleanup()
+	c.LogDriver = stubReaderLogger{}
+
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}}
+	if _, err := d.ContainerLogs(context.Background(), c.ID, config); err != logger.ErrReadLogsNotSupported {
+		t.Fatalf("expected %v, got %v", logger.ErrReadLogsNotSupported, err)
+	}
+	caps, err := d.ContainerLogsCapabilities(c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caps.ReadLogs {
+		t.Fatal("expected logs not to be readable")
+	}
+}
+
+func TestContainerLogsSnapshot(t *testing.T) {
+	d, c, cleanup := newLogsTestDaemon(t, true, "one", "two", "three")
+	defer cleanup()
+
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, Tail: "2"}}
+	snapshot, err := d.ContainerLogsSnapshot(context.Background(), c.ID, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot) != 2 || string(snapshot[0].Line) != "two\n" || string(snapshot[1].Line) != "three\n" {
+		t.Fatalf("unexpected snapshot %v", snapshot)
+	}
+
+	config.Follow = true
+	if _, err := d.ContainerLogsSnapshot(context.Background(), c.ID, config); err == nil {
+		t.Fatal("expected following a snapshot to fail")
+	}
+}
+
+func TestContainerLogsSourceSince(t *testing.T) {
+	d, c, cleanup := newLogsTestDaemon(t, false)
+	defer cleanup()
+	l, err := jsonfilelog.New(logger.Info{ContainerID: c.ID, LogPath: c.LogPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, source := range []string{"stdout", "stderr", "stdout", "stderr"} {
+		msg := &logger.Message{Line: []byte(source + strconv.Itoa(i)), Source: source, Timestamp: time.Unix(int64(i+1)*10, 0)}
+		if err := l.Log(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+
+	// stdout from a recent point, stderr from the start
+	config := &backend.ContainerLogsConfig{
+		ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true, Since: "25"},
+		SourceSince:          map[string]string{"stderr": "0"},
+	}
+	msgs, err := d.ContainerLogs(context.Background(), c.ID, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, m := range readLogMessages(t, msgs) {
+		lines = append(lines, string(m.Line))
+	}
+	expected := []string{"stderr1\n", "stdout2\n", "stderr3\n"}
+	if strings.Join(lines, "") != strings.Join(expected, "") {
+		t.Fatalf("expected %q, got %q", expected, lines)
+	}
+
+	// and the other way around
+	config.Since = ""
+	config.SourceSince = map[string]string{"stdout": "0", "stderr": "35"}
+	msgs, err = d.ContainerLogs(context.Background(), c.ID, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines = nil
+	for _, m := range readLogMessages(t, msgs) {
+		lines = append(lines, string(m.Line))
+	}
+	expected = []string{"stdout0\n", "stdout2\n", "stderr3\n"}
+	if strings.Join(lines, "") != strings.Join(expected, "") {
+		t.Fatalf("expected %q, got %q", expected, lines)
+	}
+}
+
+// fixedLogReader is a log reader that sends copies of a fixed list of
+// messages, partial flag included
+type fixedLogReader struct {
+	msgs []*logger.Message
+}
+
+func (l *fixedLogReader) Log(*logger.Message) error { return nil }
+func (l *fixedLogReader) Name() string              { return "fixed" }
+func (l *fixedLogReader) Close() error              { return nil }
+
+func (l *fixedLogReader) ReadLogs(logger.ReadConfig) *logger.LogWatcher {
+	w := logger.NewLogWatcher()
+	go func() {
+		defer close(w.Msg)
+		for _, m := range l.msgs {
+			select {
+			case w.Msg <- &logger.Message{Line: m.Line, Source: m.Source, Timestamp: m.Timestamp, Partial: m.Partial}:
+			case <-w.WatchClose():
+				return
+			}
+		}
+	}()
+	return w
+}
+
+func TestContainerLogsDropPartialMetadata(t *testing.T) {
+	d, c, cleanup := newLogsTestDaemon(t, true)
+	defer cleanup()
+	c.LogDriver = &fixedLogReader{msgs: []*logger.Message{
+		{Line: []byte("split "), Source: "stdout", Partial: true},
+		{Line: []byte("line\n"), Source: "stdout"},
+	}}
+
+	for _, drop := range []bool{false, true} {
+		config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, DropPartialMetadata: drop}
+		msgs, err := d.ContainerLogs(context.Background(), c.ID, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		read := readLogMessages(t, msgs)
+		if len(read) != 2 || string(read[0].Line) != "split " || string(read[1].Line) != "line\n" {
+			t.Fatalf("expected the fragments of the line, got %v", read)
+		}
+		if read[0].Partial == drop || read[1].Partial {
+			t.Fatalf("drop %v: unexpected partial flags %v and %v", drop, read[0].Partial, read[1].Partial)
+		}
+	}
+}
+
+func TestContainerLogsSkipsSecondaryDrivers(t *testing.T) {
+	d, c, cleanup := newLogsTestDaemon(t, false, "hello")
+	defer cleanup()
+	// reading the logs of a stopped container must not need the secondary
+	// drivers, which could be remote and unreachable
+	c.HostConfig.LogConfig.Secondary = []containertypes.LogConfig{{Type: "no-such-driver"}}
+
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}}
+	msgs, err := d.ContainerLogs(context.Background(), c.ID, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := readLogMessages(t, msgs)
+	if len(read) != 1 || string(read[0].Line) != "hello\n" {
+		t.Fatalf("unexpected messages %v", read)
+	}
+
+	caps, err := d.ContainerLogsCapabilities(c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !caps.ReadLogs {
+		t.Fatal("expected logs to be readable")
+	}
+}
+
+func TestContainerLogsDeadContainer(t *testing.T) {
+	d, c, cleanup := newLogsTestDaemon(t, false, "last words")
+	defer cleanup()
+	c.Dead = true
+
+	config := &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}}
+	if _, err := d.ContainerLogs(context.Background(), c.ID, config); err == nil || !strings.Contains(err.Error(), "dead or marked for removal") {
+		t.Fatalf("expected an error for a dead container, got %v", err)
+	}
+
+	config = &backend.ContainerLogsConfig{ContainerLogsOptions: types.ContainerLogsOptions{ShowStdout: true}, ReadDeadContainer: true}
+	msgs, err := d.ContainerLogs(context.Background(), c.ID, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := readLogMessages(t, msgs)
+	if len(read) != 1 || string(read[0].Line) != "last words\n" {
+		t.Fatalf("unexpected messages %v", read)
+	}
+
+	// once removal has taken the log file, there is nothing left to read,
+	// and starting the logger must not create a new file
+	c.Dead = false
+	c.RemovalInProgress = true
+	if err := os.Remove(c.LogPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.ContainerLogs(context.Background(), c.ID, config); err == nil || !strings.Contains(err.Error(), "dead or marked for removal") {
+		t.Fatalf("expected an error for a removed log file, got %v", err)
+	}
+	if _, err := os.Stat(c.LogPath); !os.IsNotExist(err) {
+		t.Fatalf("expected the log file to stay removed, got %v", err)
+	}
+}
+
+// failingCloseLogger is a logger that fails to close
+type failingCloseLogger struct {
+	stubReaderLogger
+}
+
+func (failingCloseLogger) Close() error { return errors.New("close failed") }
+
+// entryRecorder is a logrus hook that keeps the entries it is fired for
+type entryRecorder struct {
+	entries []*logrus.Entry
+}
+
+func (r *entryRecorder) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (r *entryRecorder) Fire(e *logrus.Entry) error {
+	r.entries = append(r.entries, e)
+	return nil
+}
+
+func TestCloseCreatedLogger(t *testing.T) {
+	l := logrus.New()
+	l.Out = ioutil.Discard
+	recorder := &entryRecorder{}
+	l.Hooks.Add(recorder)
+	lg := l.WithField("container", "foo")
+
+	closeCreatedLogger(lg, stubReaderLogger{})
+	if len(recorder.entries) != 0 {
+		t.Fatalf("expected nothing to be logged, got %v", recorder.entries)
+	}
+
+	closeCreatedLogger(lg, failingCloseLogger{})
+	if len(recorder.entries) != 1 {
+		t.Fatalf("expected the close error to be logged, got %v", recorder.entries)
+	}
+	e := recorder.entries[0]
+	if e.Level != logrus.ErrorLevel || e.Data["container"] != "foo" || e.Data["driver"] != "stub" {
+		t.Fatalf("expected an error with the fields of the stream, got %+v", e)
+	}
+	if err, ok := e.Data[logrus.ErrorKey].(error); !ok || err.Error() != "close failed" {
+		t.Fatalf("expected the close error, got %v", e.Data[logrus.ErrorKey])
+	}
+}
@@ -24,6 +24,7 @@ var (
 	engineMemory              metrics.Gauge
 	healthChecksCounter       metrics.Counter
 	healthChecksFailedCounter metrics.Counter
+	logsBackpressureTimer     metrics.Timer
 
 	stateCtr *stateCounter
 )
@@ -56,6 +57,7 @@ func init() {
 	healthChecksCounter = ns.NewCounter("health_checks", "The total number of health checks")
 	healthChecksFailedCounter = ns.NewCounter("health_checks_failed", "The total number of failed health checks")
 	imageActions = ns.NewLabeledTimer("image_actions", "The number of seconds it takes to process each image action", "action")
+	logsBackpressureTimer = ns.NewTimer("logs_backpressure", "The number of seconds log streams are blocked waiting for slow consumers")
 
 	stateCtr = newStateCounter(ns.NewDesc("container_states", "The count of containers in various states", metrics.Unit("containers"), "state"))
 	ns.Add(stateCtr)
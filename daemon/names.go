@@ -3,6 +3,7 @@ package daemon
 import (
 	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/docker/docker/api"
@@ -84,6 +85,46 @@ func (daemon *Daemon) releaseName(name string) {
 	daemon.nameIndex.Release(name)
 }
 
+// maxNameHistory is the number of previous holders remembered for each name
+const maxNameHistory = 10
+
+// nameHistory remembers the IDs of the containers that were renamed from a
+// name, so that they can still be found after the name moves on to a new
+// container. the zero value is ready to use. it is not persisted, so it only
+// covers changes since the daemon started.
+type nameHistory struct {
+	mu sync.Mutex
+	// ids holds the previous holders of each name, most recent last
+	ids map[string][]string
+}
+
+// add records that the container with the given ID no longer holds name
+func (h *nameHistory) add(name, id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.ids == nil {
+		h.ids = make(map[string][]string)
+	}
+	ids := append(h.ids[name], id)
+	if len(ids) > maxNameHistory {
+		ids = ids[len(ids)-maxNameHistory:]
+	}
+	h.ids[name] = ids
+}
+
+// get returns the IDs of the containers that previously held name, most
+// recent first
+func (h *nameHistory) get(name string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ids := h.ids[name]
+	previous := make([]string, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		previous = append(previous, ids[i])
+	}
+	return previous
+}
+
 func (daemon *Daemon) generateNewName(id string) (string, error) {
 	var name string
 	for i := 0; i < 6; i++ {
@@ -91,6 +91,7 @@ func (daemon *Daemon) ContainerRename(oldName, newName string) error {
 	}
 
 	if !container.Running {
+		daemon.nameHistory.add(oldName, container.ID)
 		daemon.LogContainerEventWithAttributes(container, "rename", attributes)
 		return nil
 	}
@@ -118,6 +119,7 @@ func (daemon *Daemon) ContainerRename(oldName, newName string) error {
 		}
 	}
 
+	daemon.nameHistory.add(oldName, container.ID)
 	daemon.LogContainerEventWithAttributes(container, "rename", attributes)
 	return nil
 }